@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// FragmentAnchor is an element other than a heading that has an id, such as
+// the <dt> of a Python function or a <div> around an example. Entries often
+// point at them, so they are indexed alongside sections.
+type FragmentAnchor struct {
+	ID    string
+	Title string
+	Lines LineRange
+}
+
+// maxFragmentTitle is the most runes of an element's text that are kept as
+// the title of its fragment.
+const maxFragmentTitle = 80
+
+// Anchors are found by marking where each one starts and ends in the HTML,
+// converting it, and then finding and removing the marks in the Markdown.
+// Marks are plain letters and digits, so the conversion leaves them alone.
+const (
+	anchorStartMark = "DEVDOCSANCHORSTART%dX"
+	anchorEndMark   = "DEVDOCSANCHOREND%dX"
+)
+
+var anchorMarkPattern = regexp.MustCompile(`DEVDOCSANCHOR(START|END)(\d+)X`)
+
+// markAnchors marks every element in sel that has an id, other than
+// headings. It returns the anchors, in the order of the numbers in their
+// marks, without their lines.
+func markAnchors(sel *goquery.Selection) []FragmentAnchor {
+	anchors := make([]FragmentAnchor, 0)
+	sel.Find("[id]").Not("h1, h2, h3, h4, h5, h6").Each(func(i int, s *goquery.Selection) {
+		id := s.AttrOr("id", "")
+		if id == "" {
+			return
+		}
+
+		n := len(anchors)
+		anchors = append(anchors, FragmentAnchor{
+			ID:    id,
+			Title: fragmentTitle(blockText(s.Nodes[0])),
+			Lines: LineRange{Start: -1, End: -1},
+		})
+		start := fmt.Sprintf(anchorStartMark, n)
+		end := fmt.Sprintf(anchorEndMark, n)
+
+		switch {
+		case s.Closest("pre").Length() > 0:
+			// Marks inside code blocks would split them, so the anchor
+			// spans the whole block.
+			pre := s.Closest("pre")
+			pre.BeforeHtml(start)
+			pre.AfterHtml(end)
+		case s.Is("li, td, th"):
+			// Anything between list items or cells would break up the list
+			// or table.
+			s.PrependHtml(start)
+			s.AppendHtml(end)
+		case s.Is("dt"):
+			// A term is described by the <dd>s that follow it.
+			block := s.NextUntil("dt")
+			if block.Length() == 0 {
+				block = s
+			}
+
+			s.BeforeHtml(start)
+			block.Last().AfterHtml(end)
+		case isEmptyNode(s.Nodes[0]):
+			// Empty elements, like <a id="..."></a>, mark a place rather
+			// than wrap content. They end where the next anchor starts,
+			// which is only known once the Markdown is indexed. Links
+			// without content would be converted to "[]()", so they go
+			// too.
+			s.ReplaceWithHtml(start)
+		default:
+			s.BeforeHtml(start)
+			s.AfterHtml(end)
+		}
+	})
+
+	return anchors
+}
+
+// isEmptyNode reports whether n has no children other than whitespace.
+// Elements without text, such as a <p> around an <img>, are not empty.
+func isEmptyNode(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.TextNode || strings.TrimSpace(c.Data) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// blockText returns the text of n, with a space between blocks, which
+// [goquery.Selection.Text] runs together.
+func blockText(n *html.Node) string {
+	buf := new(strings.Builder)
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+			return
+		}
+
+		block := n.Type == html.ElementNode && blockElements[n.DataAtom]
+		if block {
+			buf.WriteByte(' ')
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if block {
+			buf.WriteByte(' ')
+		}
+	}
+
+	walk(n)
+	return buf.String()
+}
+
+var blockElements = map[atom.Atom]bool{
+	atom.Blockquote: true,
+	atom.Br:         true,
+	atom.Dd:         true,
+	atom.Div:        true,
+	atom.Dt:         true,
+	atom.Li:         true,
+	atom.P:          true,
+	atom.Pre:        true,
+	atom.Td:         true,
+	atom.Th:         true,
+	atom.Tr:         true,
+}
+
+// fragmentTitle shortens the text of an element to a single line.
+func fragmentTitle(text string) string {
+	title := strings.Join(strings.Fields(text), " ")
+	if r := []rune(title); len(r) > maxFragmentTitle {
+		title = string(r[:maxFragmentTitle-1]) + "…"
+	}
+
+	return title
+}
+
+// removeAnchorMarks removes the marks that [markAnchors] added from the
+// Markdown, and returns the line range of each anchor in what remains. Lines
+// that only held marks are removed, along with the blank line after them.
+// Anchors without an end mark end at -1.
+func removeAnchorMarks(md []byte, anchors []FragmentAnchor) ([]byte, []FragmentAnchor, error) {
+	if len(anchors) == 0 {
+		return md, nil, nil
+	}
+
+	out := new(bytes.Buffer)
+	scanner := bufio.NewScanner(bytes.NewReader(md))
+	scanner.Buffer(nil, len(md)+1)
+
+	var lineno, lastContent int
+	var pending []int
+	var dropped bool
+	lastBlank := true
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		marks := anchorMarkPattern.FindAllSubmatch(line, -1)
+		if len(marks) > 0 {
+			line = anchorMarkPattern.ReplaceAll(line, nil)
+		}
+
+		blank := len(bytes.TrimSpace(line)) == 0
+		if dropped && blank && lastBlank {
+			dropped = false
+			continue
+		}
+		dropped = false
+
+		for _, m := range marks {
+			n, err := strconv.Atoi(string(m[2]))
+			if err != nil || n >= len(anchors) {
+				return nil, nil, fmt.Errorf("unexpected anchor mark %q", m[0])
+			}
+
+			if string(m[1]) == "START" {
+				pending = append(pending, n)
+			} else {
+				// The anchor ends with the last line that has content,
+				// which is this one unless it only held marks.
+				end := lastContent
+				if !blank {
+					end = lineno + 1
+				}
+				anchors[n].Lines.End = end
+			}
+		}
+
+		if blank && len(marks) > 0 {
+			dropped = true
+			continue
+		}
+
+		lineno++
+		out.Write(line)
+		out.WriteByte('\n')
+		lastBlank = blank
+
+		if !blank {
+			lastContent = lineno
+			for _, n := range pending {
+				anchors[n].Lines.Start = lineno
+			}
+			pending = pending[:0]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// Drop anchors that had no content after them, and fix up ones that
+	// ended before they started because their content was empty.
+	found := make([]FragmentAnchor, 0, len(anchors))
+	for _, a := range anchors {
+		if a.Lines.Start < 0 {
+			continue
+		}
+
+		if a.Lines.End >= 0 && a.Lines.End < a.Lines.Start {
+			a.Lines.End = a.Lines.Start
+		}
+
+		found = append(found, a)
+	}
+
+	return out.Bytes(), found, nil
+}
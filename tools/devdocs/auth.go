@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-shellwords"
+)
+
+var ErrNoCredentials = errors.New("no credentials found")
+
+const (
+	AuthBearer = "bearer"
+	AuthBasic  = "basic"
+)
+
+// AuthConfig configures how to authenticate with a remote, in a
+// [remote.<name>.auth] table of the configuration file:
+//
+//	[remote.corp-mirror.auth]
+//	type = "bearer"
+//	env = "CORP_DEVDOCS_TOKEN"
+//
+// The secret (a bearer token, or a password for basic auth) is read from the
+// first source that provides one: the env variable, the output of command, or
+// the netrc file. Netrc entries also provide the username for basic auth.
+type AuthConfig struct {
+	// Type is "bearer" (the default) or "basic".
+	Type     string `toml:"type,omitempty"`
+	Username string `toml:"username,omitempty"`
+	Env      string `toml:"env,omitempty"`
+	// Command is a credential helper that prints the secret to stdout.
+	Command string `toml:"command,omitempty"`
+	// Netrc is the path to a netrc file, or "default" for $NETRC or ~/.netrc.
+	Netrc string `toml:"netrc,omitempty"`
+}
+
+func (a AuthConfig) IsZero() bool {
+	return a == AuthConfig{}
+}
+
+// Credentials add authentication to the requests a [Client] makes.
+type Credentials interface {
+	Authenticate(req *http.Request) error
+}
+
+// NewCredentials creates credentials from the auth configuration of a
+// remote. It returns nil if no authentication is configured.
+func NewCredentials(cfg AuthConfig) (Credentials, error) {
+	if cfg.IsZero() {
+		return nil, nil
+	}
+
+	switch cfg.Type {
+	case "", AuthBearer, AuthBasic:
+	default:
+		return nil, fmt.Errorf("unknown auth type %q (expected %q or %q)", cfg.Type, AuthBearer, AuthBasic)
+	}
+
+	if cfg.Env == "" && cfg.Command == "" && cfg.Netrc == "" {
+		return nil, errors.New("auth needs at least one of env, command or netrc")
+	}
+
+	return &configuredCredentials{config: cfg}, nil
+}
+
+type configuredCredentials struct {
+	config AuthConfig
+
+	// The command is only run once, the first time it is needed.
+	once   sync.Once
+	secret string
+	err    error
+
+	// Likewise, the netrc file is only read once.
+	netrcOnce sync.Once
+	netrc     *netrcFile
+	netrcErr  error
+}
+
+// Authenticate implements the [Credentials] interface.
+func (c *configuredCredentials) Authenticate(req *http.Request) error {
+	username := c.config.Username
+
+	secret, err := c.helperSecret()
+	if err != nil {
+		return err
+	}
+
+	if secret == "" && c.config.Netrc != "" {
+		c.netrcOnce.Do(func() {
+			c.netrc, c.netrcErr = readNetrc(c.config.Netrc)
+		})
+		if c.netrcErr != nil {
+			return c.netrcErr
+		}
+
+		login, password := c.netrc.Lookup(req.URL.Hostname())
+
+		secret = password
+		if username == "" {
+			username = login
+		}
+	}
+
+	if secret == "" {
+		return fmt.Errorf("could not authenticate with %s: %w", req.URL.Host, ErrNoCredentials)
+	}
+
+	if c.config.Type == AuthBasic {
+		req.SetBasicAuth(username, secret)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	return nil
+}
+
+// helperSecret reads the secret from the env variable or credential helper,
+// whichever is configured and non-empty.
+func (c *configuredCredentials) helperSecret() (string, error) {
+	if c.config.Env != "" {
+		if s := os.Getenv(c.config.Env); s != "" {
+			return s, nil
+		}
+	}
+
+	if c.config.Command == "" {
+		return "", nil
+	}
+
+	c.once.Do(func() {
+		c.secret, c.err = runCredentialHelper(c.config.Command)
+	})
+
+	return c.secret, c.err
+}
+
+func runCredentialHelper(command string) (string, error) {
+	words, err := shellwords.Parse(command)
+	if err != nil || len(words) == 0 {
+		return "", fmt.Errorf("could not parse credential command %q", command)
+	}
+
+	stdout := new(bytes.Buffer)
+	cmd := exec.Command(words[0], words[1:]...)
+	cmd.Stdout = stdout
+	// Let the helper prompt for e.g. a passphrase.
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("credential command %q failed: %w", command, err)
+	}
+
+	// Only the first line counts, like with git credential helpers.
+	line, _, _ := strings.Cut(stdout.String(), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// netrcFile holds the credentials of a netrc file.
+type netrcFile struct {
+	machines map[string]netrcEntry
+	// def is the default entry, for hosts without a machine entry.
+	def *netrcEntry
+}
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// Lookup finds the login and password for host. Unknown hosts without a
+// default entry yield empty credentials.
+func (n *netrcFile) Lookup(host string) (login string, password string) {
+	if e, ok := n.machines[host]; ok {
+		return e.login, e.password
+	}
+
+	if n.def != nil {
+		return n.def.login, n.def.password
+	}
+
+	return "", ""
+}
+
+// readNetrc reads a netrc file. A missing file has no credentials.
+func readNetrc(path string) (*netrcFile, error) {
+	if path == "default" {
+		path = os.Getenv("NETRC")
+	}
+
+	if path == "default" || path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		path = filepath.Join(home, ".netrc")
+	}
+
+	data, err := os.ReadFile(expandHome(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return parseNetrc(nil)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return parseNetrc(data)
+}
+
+// parseNetrc parses the contents of a netrc file. It is a stream of
+// whitespace-separated tokens. An entry starts with "machine <host>" or
+// "default", followed by "login" and "password" pairs (among others). Macros
+// defined with "macdef <name>" run from the next line to a blank line, and
+// are skipped. The first entry for a host wins.
+func parseNetrc(data []byte) (*netrcFile, error) {
+	n := &netrcFile{machines: make(map[string]netrcEntry)}
+
+	var cur *netrcEntry
+	var host string
+	var isDefault bool
+	flush := func() {
+		if cur == nil {
+			return
+		}
+
+		if isDefault {
+			if n.def == nil {
+				n.def = cur
+			}
+		} else if _, ok := n.machines[host]; !ok {
+			n.machines[host] = *cur
+		}
+		cur = nil
+	}
+
+	// Values can be on a different line than their keyword, so the keyword
+	// that a value is wanted for is kept between lines.
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var want string
+	var inMacro bool
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		for _, token := range strings.Fields(line) {
+			if want != "" {
+				switch want {
+				case "machine":
+					host = token
+				case "login":
+					if cur != nil {
+						cur.login = token
+					}
+				case "password":
+					if cur != nil {
+						cur.password = token
+					}
+				case "macdef":
+					// The macro starts on the next line.
+					inMacro = true
+				}
+
+				want = ""
+				if inMacro {
+					break
+				}
+				continue
+			}
+
+			switch token {
+			case "machine":
+				flush()
+				host, isDefault = "", false
+				cur = new(netrcEntry)
+				want = token
+			case "default":
+				flush()
+				host, isDefault = "", true
+				cur = new(netrcEntry)
+			case "login", "password", "account", "macdef":
+				want = token
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read netrc: %w", err)
+	}
+
+	flush()
+	return n, nil
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
+
+// redactURL hides any password in a URL, so it can be logged.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid URL>"
+	}
+
+	return u.Redacted()
+}
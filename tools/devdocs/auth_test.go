@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestParseNetrc(t *testing.T) {
+	const netrc = `machine first.example.com login one password secret1
+macdef init
+cd /pub
+machine fake.example.com login nope password nope
+
+machine second.example.com
+  login two
+  password
+  secret2
+
+machine first.example.com login dup password dup
+default login anon password guest
+`
+
+	tests := []struct {
+		host     string
+		login    string
+		password string
+	}{
+		{host: "first.example.com", login: "one", password: "secret1"},
+		{host: "second.example.com", login: "two", password: "secret2"},
+		{host: "fake.example.com", login: "anon", password: "guest"},
+		{host: "other.example.com", login: "anon", password: "guest"},
+	}
+
+	n, err := parseNetrc([]byte(netrc))
+	if err != nil {
+		t.Fatalf("parseNetrc() error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			login, password := n.Lookup(tt.host)
+			if login != tt.login || password != tt.password {
+				t.Errorf("Lookup(%q) = %q, %q, want %q, %q", tt.host, login, password, tt.login, tt.password)
+			}
+		})
+	}
+}
+
+func TestParseNetrcWithoutDefault(t *testing.T) {
+	n, err := parseNetrc([]byte("machine example.com login me password pw\n"))
+	if err != nil {
+		t.Fatalf("parseNetrc() error = %v", err)
+	}
+
+	if login, password := n.Lookup("other.com"); login != "" || password != "" {
+		t.Errorf("Lookup(%q) = %q, %q, want empty credentials", "other.com", login, password)
+	}
+}
@@ -1,16 +1,123 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
+// ResourceKind identifies the kind of DevDocs resource stored in the cache.
+// Each kind lives in its own subdirectory and has its own TTL.
+type ResourceKind string
+
+const (
+	// ResourceDocsets is the list of docsets (docs.json).
+	ResourceDocsets ResourceKind = "docsets"
+	// ResourceIndex is the list of entries in a docset (index.json).
+	ResourceIndex ResourceKind = "index"
+	// ResourceDocument is the HTML for a single document in a docset.
+	ResourceDocument ResourceKind = "documents"
+	// ResourceMarkdown is a document converted to Markdown, along with its
+	// index. It is keyed by its content, so it never goes stale.
+	ResourceMarkdown ResourceKind = "markdown"
+)
+
+// CacheTTL configures how long each kind of resource is considered fresh.
+// Stale resources are revalidated with DevDocs before they are used.
+type CacheTTL struct {
+	Docsets   time.Duration `help:"How long to cache the list of docsets" default:"24h" env:"DOCSETS"`
+	Index     time.Duration `help:"How long to cache the entries in a docset" default:"24h" env:"INDEX"`
+	Documents time.Duration `help:"How long to cache documents" default:"168h" env:"DOCUMENTS"`
+}
+
+var DefaultCacheTTL = CacheTTL{
+	Docsets:   24 * time.Hour,
+	Index:     24 * time.Hour,
+	Documents: 7 * 24 * time.Hour,
+}
+
+func (t CacheTTL) For(kind ResourceKind) time.Duration {
+	switch kind {
+	case ResourceDocsets:
+		return t.Docsets
+	case ResourceIndex:
+		return t.Index
+	case ResourceDocument:
+		return t.Documents
+	default:
+		return 0
+	}
+}
+
+// CacheMeta holds the HTTP validators for a cached resource, along with the
+// time the resource was last fetched or revalidated.
+type CacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// CacheItem is a resource read from the cache.
+type CacheItem struct {
+	Meta CacheMeta
+	Data []byte
+}
+
+// IsFresh reports whether the item was fetched within the given TTL.
+func (c *CacheItem) IsFresh(ttl time.Duration) bool {
+	return time.Since(c.Meta.FetchedAt) < ttl
+}
+
+// CanRevalidate reports whether the item has any validators that can be sent
+// along with a conditional request.
+func (c *CacheItem) CanRevalidate() bool {
+	return c.Meta.ETag != "" || c.Meta.LastModified != ""
+}
+
+// Cache stores DevDocs resources on disk. Each resource is stored as-is, next
+// to a small JSON file holding its metadata.
+//
+// A cache can have shared layers: read-only caches, e.g. provisioned for a
+// team, that resources and installed docsets are read from when they are not
+// in the cache itself. Writes only ever go to the cache itself.
 type Cache struct {
-	dir string
+	dir         string
+	shared      []*Cache
+	compression Compression
+	// readOnly is true for shared layers.
+	readOnly bool
+}
+
+type CacheOptions struct {
+	// Shared are the directories of the shared layers, in order of
+	// priority.
+	Shared []string
+	// Compression is used for documents, Markdown and installed databases.
+	// Other files are read as-is by other code, so they are never
+	// compressed.
+	Compression Compression
 }
 
-func NewCache(dir string) *Cache {
-	return &Cache{dir: dir}
+// NewCache creates a cache in dir.
+func NewCache(dir string, opts CacheOptions) *Cache {
+	c := &Cache{
+		dir:         dir,
+		compression: opts.Compression,
+	}
+
+	for _, d := range opts.Shared {
+		c.shared = append(c.shared, &Cache{dir: d, readOnly: true})
+	}
+
+	return c
 }
 
 func userCacheDir() (string, error) {
@@ -21,3 +128,182 @@ func userCacheDir() (string, error) {
 
 	return path.Join(d, "devdocs"), nil
 }
+
+// Dir returns the root directory of the cache.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Path returns the location of a resource within the cache. The key is a
+// slash-separated path relative to the directory for the resource kind.
+func (c *Cache) Path(kind ResourceKind, key string) (string, error) {
+	rel := filepath.FromSlash(key)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid cache key %q", key)
+	}
+
+	return filepath.Join(c.dir, string(kind), rel), nil
+}
+
+// Get reads a resource from the cache, falling back to the shared layers. If
+// the resource is not cached, the returned error satisfies
+// errors.Is(err, fs.ErrNotExist).
+func (c *Cache) Get(kind ResourceKind, key string) (*CacheItem, error) {
+	item, err := c.get(kind, key)
+	if !isCacheMiss(err) {
+		return item, err
+	}
+
+	for _, l := range c.shared {
+		item, lerr := l.get(kind, key)
+		if lerr == nil {
+			slog.Debug("using resource from shared cache", "dir", l.dir, "kind", kind, "key", key)
+			return item, nil
+		} else if !isCacheMiss(lerr) {
+			slog.Debug("failed to read from shared cache", "dir", l.dir, "kind", kind, "key", key, "err", lerr)
+		}
+	}
+
+	return nil, err
+}
+
+func (c *Cache) get(kind ResourceKind, key string) (*CacheItem, error) {
+	p, err := c.Path(kind, key)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, locked, err := c.tryLock(false, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	meta, err := readCacheMeta(p)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// The modification time of a resource tracks when it was last used, so
+	// that pruning can remove the least recently used ones. It's only
+	// updated under the lock, which pruning waits for, and caches that can't
+	// be locked can't be written to either.
+	if locked && !c.readOnly {
+		now := time.Now()
+		if err := os.Chtimes(p, now, now); err != nil {
+			slog.Debug("failed to update access time of cached resource", "path", p, "err", err)
+		}
+	}
+
+	return &CacheItem{
+		Meta: meta,
+		Data: data,
+	}, nil
+}
+
+// Put writes a resource and its metadata to the cache. Each file is replaced
+// atomically. Documents are compressed, so [Cache.Get] returns them as-is
+// for [DocumentContent] to decompress.
+func (c *Cache) Put(kind ResourceKind, key string, data []byte, meta CacheMeta) error {
+	p, err := c.Path(kind, key)
+	if err != nil {
+		return err
+	}
+
+	if isDocumentResource(kind, key) {
+		data, err = compress(data, c.compression)
+		if err != nil {
+			return err
+		}
+	}
+
+	unlock, err := c.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(p, data, 0o644); err != nil {
+		return err
+	}
+
+	return writeCacheMeta(p, meta)
+}
+
+// Touch replaces the metadata for a cached resource, e.g. after DevDocs
+// confirmed that the cached copy is still valid. Resources from a shared
+// layer are copied into the cache.
+func (c *Cache) Touch(kind ResourceKind, key string, meta CacheMeta) error {
+	p, err := c.Path(kind, key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(p); isCacheMiss(err) && len(c.shared) > 0 {
+		item, err := c.Get(kind, key)
+		if err != nil {
+			return err
+		}
+
+		return c.Put(kind, key, item.Data, meta)
+	}
+
+	unlock, err := c.lockWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(p); err != nil {
+		return err
+	}
+
+	return writeCacheMeta(p, meta)
+}
+
+// isDocumentResource reports whether a resource is the content of a
+// document, as opposed to data that is parsed, like lists and indexes.
+func isDocumentResource(kind ResourceKind, key string) bool {
+	return kind == ResourceDocument || (kind == ResourceMarkdown && strings.HasSuffix(key, ".md"))
+}
+
+func metaPath(p string) string {
+	return p + ".meta"
+}
+
+func readCacheMeta(p string) (CacheMeta, error) {
+	var meta CacheMeta
+
+	data, err := os.ReadFile(metaPath(p))
+	if err != nil {
+		return meta, err
+	}
+
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("could not parse cache metadata for %q: %w", p, err)
+	}
+
+	return meta, nil
+}
+
+func writeCacheMeta(p string, meta CacheMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(metaPath(p), data, 0o644)
+}
+
+func isCacheMiss(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutLocksFreshCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "does", "not", "exist")
+	c := NewCache(dir, CacheOptions{})
+
+	err := c.Put(ResourceDocsets, "public/docs.json", []byte("[]"), CacheMeta{FetchedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	// The lock file only exists if the write was made under the lock.
+	if _, err := os.Stat(filepath.Join(dir, cacheLockFile)); err != nil {
+		t.Errorf("Put() wrote without a lock: %v", err)
+	}
+}
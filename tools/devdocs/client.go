@@ -18,37 +18,104 @@ const (
 	DefaultDevDocsDocumentsURL = "https://documents.devdocs.io"
 )
 
-var ErrNotFound = errors.New("resource not found")
+var (
+	ErrNotFound = errors.New("resource not found")
+	// ErrOffline means a resource is neither cached nor installed, and
+	// offline mode prevents fetching it.
+	ErrOffline = errors.New("not available offline")
+)
 
 type Client struct {
 	*http.Client
+	name         string
 	rootURL      *url.URL
 	documentsURL *url.URL
+	cache        *Cache
+	ttl          CacheTTL
+	credentials  Credentials
+	retry        RetryPolicy
+	offline      bool
+	limiter      *rateLimiter
 }
 
 type ClientOptions struct {
+	// Name identifies the remote the client talks to. Responses from each
+	// remote are cached separately.
+	Name         string
 	Client       *http.Client
 	RootURL      string
 	DocumentsURL string
+	// Cache stores responses from DevDocs on disk. If nil, every request
+	// goes to the network.
+	Cache *Cache
+	TTL   CacheTTL
+	// Credentials authenticate every request to the remote, if set.
+	Credentials Credentials
+	// Retry configures how transient failures are retried. The zero value
+	// disables retries.
+	Retry RetryPolicy
+	// Offline prevents all requests. Cached resources are used however
+	// stale they are, and anything else fails with [ErrOffline].
+	Offline bool
 }
 
 var httpClient = &http.Client{
 	Timeout: 10 * time.Second,
 }
 
-func NewClient(opts ClientOptions) *Client {
+// NewClient creates a client for a remote. It fails if either URL is
+// invalid.
+func NewClient(opts ClientOptions) (*Client, error) {
 	c := opts.Client
 	if c == nil {
 		c = httpClient
 	}
 
+	rootURL, err := url.Parse(opts.RootURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid root URL: %w", err)
+	}
+
+	documentsURL, err := url.Parse(opts.DocumentsURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid documents URL: %w", err)
+	}
+
 	return &Client{
 		Client:       c,
-		rootURL:      mustParseURL(opts.RootURL),
-		documentsURL: mustParseURL(opts.DocumentsURL),
-	}
+		name:         opts.Name,
+		rootURL:      rootURL,
+		documentsURL: documentsURL,
+		cache:        opts.Cache,
+		ttl:          opts.TTL,
+		credentials:  opts.Credentials,
+		retry:        opts.Retry,
+		offline:      opts.Offline,
+	}, nil
+}
+
+// Name returns the name of the remote the client talks to.
+func (c *Client) Name() string {
+	return c.name
 }
 
+// Revalidating returns a copy of the client that treats every cached resource
+// as stale, so they are always revalidated with DevDocs before use.
+func (c *Client) Revalidating() *Client {
+	cp := *c
+	cp.ttl = CacheTTL{}
+	return &cp
+}
+
+// RateLimited returns a copy of the client that waits for l before every
+// request it sends, including retries.
+func (c *Client) RateLimited(l *rateLimiter) *Client {
+	cp := *c
+	cp.limiter = l
+	return &cp
+}
+
+// mustParseURL parses a URL that is known to be valid, such as a constant.
 func mustParseURL(rawURL string) *url.URL {
 	url, err := url.Parse(rawURL)
 	if err != nil {
@@ -62,18 +129,12 @@ func (c *Client) ListDocsets(ctx context.Context) ([]Docset, error) {
 	list := make([]Docset, 0)
 
 	u := c.rootURL.JoinPath("/docs/docs.json").String()
-	res, err := c.get(ctx, u)
-	if err != nil {
-		return list, err
-	}
-
-	j := json.NewDecoder(res.Body)
-	err = j.Decode(&list)
+	data, err := c.fetch(ctx, ResourceDocsets, "docs.json", u)
 	if err != nil {
 		return list, err
 	}
 
-	err = res.Body.Close()
+	err = json.Unmarshal(data, &list)
 	if err != nil {
 		return list, err
 	}
@@ -87,36 +148,145 @@ func (c *Client) ListEntries(ctx context.Context, docset string) (EntryManifest,
 	}
 
 	u := c.rootURL.JoinPath("/docs/", docset, "/index.json").String()
-	res, err := c.get(ctx, u)
+	data, err := c.fetch(ctx, ResourceIndex, docset+"/index.json", u)
 	if err != nil {
 		return m, fmt.Errorf("searched for docset with slug %q: %w", docset, err)
 	}
 
-	j := json.NewDecoder(res.Body)
-	err = j.Decode(&m)
+	err = json.Unmarshal(data, &m)
 	if err != nil {
 		return m, err
 	}
 
-	err = res.Body.Close()
-	if err != nil {
-		return m, nil
-	}
-
 	m.Docset = docset
 	return m, nil
 }
 
 func (c *Client) GetDocument(ctx context.Context, docset string, entry EntryLocator) (*HTMLDocument, error) {
 	u := c.documentsURL.JoinPath("/", docset, "/", entry.Path+".html").String()
-	res, err := c.get(ctx, u)
+	data, err := c.fetch(ctx, ResourceDocument, docset+"/"+entry.Path+".html", u)
 	if err != nil {
 		return nil, fmt.Errorf("searched for path %q in docset %q: %w", entry.Path, docset, err)
 	}
 
+	return NewHTMLDocument(docset, entry, data), nil
+}
+
+// DownloadIndex downloads the index.json of a docset, bypassing the cache.
+func (c *Client) DownloadIndex(ctx context.Context, docset string) ([]byte, error) {
+	u := c.rootURL.JoinPath("/docs/", docset, "/index.json").String()
+	res, err := c.get(ctx, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("searched for index of docset %q: %w", docset, err)
+	}
+
+	return readBody(res)
+}
+
+// DownloadDatabase downloads the db.json of a docset, which bundles every
+// document in the docset, bypassing the cache.
+func (c *Client) DownloadDatabase(ctx context.Context, docset string) ([]byte, error) {
+	u := c.documentsURL.JoinPath("/", docset, "/db.json").String()
+	res, err := c.get(ctx, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("searched for database of docset %q: %w", docset, err)
+	}
+
+	return readBody(res)
+}
+
+// fetch reads the resource at url, going through the cache if the client has
+// one. Fresh cached resources are returned without a request. Stale ones are
+// revalidated with their ETag or Last-Modified validators, and are still used
+// (with a warning) if DevDocs can't be reached.
+func (c *Client) fetch(ctx context.Context, kind ResourceKind, key string, url string) ([]byte, error) {
+	if c.cache == nil {
+		res, err := c.get(ctx, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return readBody(res)
+	}
+
+	if c.name != "" {
+		key = c.name + "/" + key
+	}
+
+	item, err := c.cache.Get(kind, key)
+	if err != nil {
+		if !isCacheMiss(err) {
+			slog.Debug("failed to read from cache", "kind", kind, "key", key, "err", err)
+		}
+		item = nil
+	}
+
+	if item != nil && (c.offline || item.IsFresh(c.ttl.For(kind))) {
+		slog.Debug("using cached resource", "kind", kind, "key", key, "fetched", item.Meta.FetchedAt)
+		return item.Data, nil
+	}
+
+	header := make(http.Header)
+	if item != nil {
+		if item.Meta.ETag != "" {
+			header.Set("If-None-Match", item.Meta.ETag)
+		}
+		if item.Meta.LastModified != "" {
+			header.Set("If-Modified-Since", item.Meta.LastModified)
+		}
+	}
+
+	res, err := c.get(ctx, url, header)
+	if err != nil {
+		if item != nil && canUseStale(err) {
+			slog.Warn(
+				"could not reach DevDocs, using stale cached data",
+				"remote", c.name,
+				"key", key,
+				"fetched", item.Meta.FetchedAt.Format(time.DateTime),
+				"err", err,
+			)
+			return item.Data, nil
+		}
+
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && item != nil {
+		res.Body.Close()
+		slog.Debug("revalidated cached resource", "kind", kind, "key", key)
+
+		item.Meta.FetchedAt = time.Now()
+		if err := c.cache.Touch(kind, key, item.Meta); err != nil {
+			slog.Debug("failed to update cache", "kind", kind, "key", key, "err", err)
+		}
+
+		return item.Data, nil
+	}
+
+	data, err := readBody(res)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := CacheMeta{
+		URL:          url,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	if err := c.cache.Put(kind, key, data, meta); err != nil {
+		slog.Debug("failed to write to cache", "kind", kind, "key", key, "err", err)
+	}
+
+	return data, nil
+}
+
+func readBody(res *http.Response) ([]byte, error) {
 	buf := new(bytes.Buffer)
-	_, err = io.Copy(buf, res.Body)
+	_, err := io.Copy(buf, res.Body)
 	if err != nil {
+		res.Body.Close()
 		return nil, err
 	}
 
@@ -125,43 +295,104 @@ func (c *Client) GetDocument(ctx context.Context, docset string, entry EntryLoca
 		return nil, err
 	}
 
-	return NewHTMLDocument(docset, entry, buf.Bytes()), nil
+	return buf.Bytes(), nil
 }
 
-func (c *Client) get(ctx context.Context, url string) (*http.Response, error) {
-	slog.Debug("initiating request", "url", url, "method", "GET")
+// get requests url, retrying transient failures according to the client's
+// retry policy. Error responses are closed and turned into errors that can be
+// tested for with errors.Is, such as [ErrNotFound] or [ErrUnavailable].
+func (c *Client) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	// The URL may hold credentials of its own, so never log it as-is. The
+	// headers, which hold the rest, are never logged at all.
+	logURL := redactURL(url)
+
+	slog.Debug("initiating request", "url", logURL, "method", "GET")
 	req, err := http.NewRequestWithContext(ctx, "GET", url, http.NoBody)
 	if err != nil {
-		slog.Debug("failed to create request", "url", url, "err", err)
+		slog.Debug("failed to create request", "url", logURL, "err", err)
 		return nil, err
 	}
 
+	// Checked before authenticating, which may run credential helpers.
+	if c.offline {
+		slog.Debug("not sending request in offline mode", "url", logURL)
+		return nil, ErrOffline
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if c.credentials != nil {
+		if err := c.credentials.Authenticate(req); err != nil {
+			slog.Debug("failed to authenticate request", "url", logURL, "remote", c.name)
+			return nil, err
+		}
+	}
+
+	for retry := 0; ; retry++ {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		res, retryAfter, err := c.do(req, logURL)
+		if err == nil || retry >= c.retry.Limit || !isRetryable(err) || ctx.Err() != nil {
+			return res, err
+		}
+
+		slog.Debug("retrying request", "url", logURL, "retry", retry+1, "retry-after", retryAfter, "err", err)
+		if !c.retry.wait(ctx, retry, retryAfter) {
+			return nil, err
+		}
+	}
+}
+
+// canUseStale reports whether a stale cached resource can stand in for a
+// request that failed with err. A resource that no longer exists can't.
+func canUseStale(err error) bool {
+	return !errors.Is(err, ErrNotFound) && !errors.Is(err, context.Canceled)
+}
+
+// do sends a single request. Along with any error, it returns how long the
+// server asked to wait before trying again, if at all.
+func (c *Client) do(req *http.Request, logURL string) (*http.Response, time.Duration, error) {
 	res, err := c.Do(req)
 	if err != nil {
-		slog.Debug("failed to get response", "url", url, "err", err)
-		return nil, err
+		slog.Debug("failed to get response", "url", logURL, "err", err)
+		return nil, 0, transportError(err)
 	}
 
 	slog.Debug(
 		"got response from DevDocs",
-		"url", url,
+		"url", logURL,
 		"status", res.Status,
 		"content-type", res.Header.Get("Content-Type"),
 	)
 
-	if res.StatusCode < 200 || res.StatusCode >= 400 {
-		if res.StatusCode == http.StatusNotFound {
-			return nil, ErrNotFound
-		} else {
-			return nil, fmt.Errorf("received HTTP error from DevDocs: %s", res.Status)
-		}
+	if err := statusError(res); err != nil {
+		res.Body.Close()
+		return nil, parseRetryAfter(res.Header.Get("Retry-After"), time.Now()), err
 	}
 
-	return res, nil
+	return res, 0, nil
 }
 
-var DefaultClient = NewClient(ClientOptions{
+var DefaultClient = mustNewClient(ClientOptions{
+	Name:         PublicRemote,
 	Client:       httpClient,
 	RootURL:      DefaultDevDocsURL,
 	DocumentsURL: DefaultDevDocsDocumentsURL,
+	TTL:          DefaultCacheTTL,
+	Retry:        DefaultRetryPolicy,
 })
+
+func mustNewClient(opts ClientOptions) *Client {
+	c, err := NewClient(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
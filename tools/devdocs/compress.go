@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is how files are compressed in the cache. Compressed files are
+// recognized by their magic numbers, so files compressed with any of them
+// (or none) can be read regardless of the current setting.
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// minCompressedSize is the size below which files are stored as-is, since
+// compressing them saves little and costs a decoder on every read.
+const minCompressedSize = 1024
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+)
+
+// compress compresses data with the given compression, unless it is too
+// small to be worth it, or doesn't get any smaller.
+func compress(data []byte, c Compression) ([]byte, error) {
+	if len(data) < minCompressedSize || isCompressed(data) {
+		return data, nil
+	}
+
+	var out []byte
+	switch c {
+	case CompressionGzip:
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		out = buf.Bytes()
+	case CompressionZstd:
+		e, err := zstdEncoder()
+		if err != nil {
+			return nil, fmt.Errorf("could not create zstd encoder: %w", err)
+		}
+
+		out = e.EncodeAll(data, nil)
+	case CompressionNone, "":
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", c)
+	}
+
+	if len(out) >= len(data) {
+		return data, nil
+	}
+
+	return out, nil
+}
+
+func isCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, zstdMagic) || bytes.HasPrefix(data, gzipMagic)
+}
+
+// decompress returns the uncompressed contents of data, which is returned
+// as-is if it is not compressed.
+func decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, zstdMagic):
+		d, err := zstdDecoder()
+		if err != nil {
+			return nil, fmt.Errorf("could not create zstd decoder: %w", err)
+		}
+
+		return d.DecodeAll(data, nil)
+	case bytes.HasPrefix(data, gzipMagic):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		return io.ReadAll(r)
+	default:
+		return data, nil
+	}
+}
+
+// decompressReader wraps r to decompress what it reads, if it is compressed.
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+// uncompressedSize returns the size of the contents of a file, if it is
+// compressed, or else its size.
+func uncompressedSize(name string) (int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	header := make([]byte, zstd.HeaderMaxSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, zstdMagic):
+		var h zstd.Header
+		if err := h.Decode(header); err == nil && h.HasFCS {
+			return int64(h.FrameContentSize), nil
+		}
+	case bytes.HasPrefix(header, gzipMagic) && info.Size() >= 4:
+		// The last four bytes hold the size, modulo 2^32.
+		trailer := make([]byte, 4)
+		if _, err := f.ReadAt(trailer, info.Size()-4); err != nil {
+			return 0, err
+		}
+
+		return int64(binary.LittleEndian.Uint32(trailer)), nil
+	}
+
+	return info.Size(), nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/alecthomas/kong"
+)
+
+// Config is the devdocs configuration file. It is a TOML document whose keys
+// are the names of command-line flags, and whose values are used as the
+// defaults for those flags. Tables are flattened by joining their keys with
+// dashes, so these are equivalent:
+//
+//	cache-ttl-documents = "720h"
+//
+//	[cache-ttl]
+//	documents = "720h"
+//
+// Flags given on the command line or through DEVDOCS_* environment variables
+// take precedence over the configuration file.
+//
+// Remotes are the exception: they are configured in [remote.<name>] tables
+// (see [RemoteConfig]) rather than through flags.
+type Config struct {
+	path    string
+	values  map[string]any
+	remotes map[string]RemoteConfig
+}
+
+// ConfigValue is a single key in the configuration file.
+type ConfigValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// IsDefault is true when the key is not configured, and Value is the
+	// flag's built-in default.
+	IsDefault bool `json:"is_default"`
+}
+
+// DefaultConfigPath returns the location of the configuration file, which is
+// $DEVDOCS_CONFIG if set, or devdocs/config.toml in $XDG_CONFIG_HOME (which
+// defaults to ~/.config).
+func DefaultConfigPath() (string, error) {
+	if p := os.Getenv("DEVDOCS_CONFIG"); p != "" {
+		return p, nil
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "devdocs", "config.toml"), nil
+}
+
+// NewConfig creates an empty configuration that will be saved to path.
+func NewConfig(path string) *Config {
+	return &Config{
+		path:    path,
+		values:  make(map[string]any),
+		remotes: make(map[string]RemoteConfig),
+	}
+}
+
+// LoadConfig reads the configuration file at path. A missing file is treated
+// as an empty configuration.
+func LoadConfig(path string) (*Config, error) {
+	c := NewConfig(path)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return nil, fmt.Errorf("could not parse config file %q: %w", path, err)
+	}
+
+	var remotes struct {
+		Remote map[string]RemoteConfig `toml:"remote"`
+	}
+	if _, err := toml.Decode(string(data), &remotes); err != nil {
+		return nil, fmt.Errorf("could not parse remotes in config file %q: %w", path, err)
+	}
+
+	for name, r := range remotes.Remote {
+		if r.URL == "" {
+			return nil, fmt.Errorf("remote %q in config file %q has no url", name, path)
+		}
+
+		c.remotes[name] = r
+	}
+
+	delete(raw, "remote")
+	flattenConfig("", raw, c.values)
+	return c, nil
+}
+
+func flattenConfig(prefix string, raw map[string]any, out map[string]any) {
+	for k, v := range raw {
+		if prefix != "" {
+			k = prefix + "-" + k
+		}
+
+		if table, ok := v.(map[string]any); ok {
+			flattenConfig(k, table, out)
+		} else {
+			out[k] = v
+		}
+	}
+}
+
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Get returns the configured value for a key, formatted as it would be on
+// the command line.
+func (c *Config) Get(key string) (string, bool) {
+	v, ok := c.values[key]
+	if !ok {
+		return "", false
+	}
+
+	return formatConfigValue(v), true
+}
+
+// Set changes the value for a key. Call [Config.Save] to persist it.
+func (c *Config) Set(key string, value string) {
+	c.values[key] = value
+}
+
+// Keys returns the configured keys in sorted order.
+func (c *Config) Keys() []string {
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Remote returns the configuration of a named remote.
+func (c *Config) Remote(name string) (RemoteConfig, bool) {
+	r, ok := c.remotes[name]
+	return r, ok
+}
+
+// DefaultRemotes returns the names of the configured remotes by priority,
+// followed by the public remote unless it was configured explicitly.
+func (c *Config) DefaultRemotes() []string {
+	names := sortRemoteNames(c.remotes)
+	if _, ok := c.remotes[PublicRemote]; !ok {
+		names = append(names, PublicRemote)
+	}
+
+	return names
+}
+
+// Save writes the configuration back to its file. Tables are written as
+// flat keys.
+func (c *Config) Save() error {
+	doc := make(map[string]any, len(c.values)+1)
+	for k, v := range c.values {
+		doc[k] = v
+	}
+
+	if len(c.remotes) > 0 {
+		doc["remote"] = c.remotes
+	}
+
+	buf := new(bytes.Buffer)
+	if err := toml.NewEncoder(buf).Encode(doc); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.path, buf.Bytes(), 0o644)
+}
+
+func formatConfigValue(v any) string {
+	switch v := v.(type) {
+	case []any:
+		parts := make([]string, len(v))
+		for i, p := range v {
+			parts[i] = formatConfigValue(p)
+		}
+
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Resolver returns a kong resolver that fills in unset flags from the
+// configuration file.
+func (c *Config) Resolver() kong.Resolver {
+	return configResolver{c}
+}
+
+type configResolver struct {
+	config *Config
+}
+
+// Validate implements the [kong.Resolver] interface by rejecting keys that
+// don't match any flag.
+func (r configResolver) Validate(app *kong.Application) error {
+	known := configFlags(app)
+
+	var unknown []string
+	for _, k := range r.config.Keys() {
+		if _, ok := known[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown keys in config file %q: %s", r.config.path, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// Resolve implements the [kong.Resolver] interface.
+func (r configResolver) Resolve(ctx *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	// Environment variables take precedence over the configuration file.
+	for _, env := range flag.Envs {
+		if _, ok := os.LookupEnv(env); ok {
+			return nil, nil
+		}
+	}
+
+	v, ok := r.config.Get(flag.Name)
+	if !ok {
+		return nil, nil
+	}
+
+	return v, nil
+}
+
+// validateConfigValue checks that value would be accepted by the flag on the
+// command line.
+func validateConfigValue(f *kong.Flag, value string) error {
+	target := reflect.New(f.Target.Type()).Elem()
+	scan := kong.ScanFromTokens(kong.Token{Type: kong.FlagValueToken, Value: value})
+	if err := f.Parse(scan, target); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", f.ShortSummary(), err)
+	}
+
+	if f.Enum != "" && !f.EnumMap()[value] {
+		return fmt.Errorf("invalid value for %s: must be one of %s", f.ShortSummary(), strings.Join(f.EnumSlice(), ","))
+	}
+
+	return nil
+}
+
+// configFlags returns every flag in the application, keyed by name.
+func configFlags(app *kong.Application) map[string]*kong.Flag {
+	flags := make(map[string]*kong.Flag)
+
+	_ = kong.Visit(app, func(node kong.Visitable, next kong.Next) error {
+		if f, ok := node.(*kong.Flag); ok && f.Name != "help" {
+			flags[f.Name] = f
+		}
+
+		return next(nil)
+	})
+
+	return flags
+}
@@ -5,6 +5,9 @@ type Docset struct {
 	Name    string `json:"name"`
 	Slug    string `json:"slug"`
 	Release string `json:"release"`
+	// Mtime is the Unix timestamp of the last time DevDocs rebuilt the
+	// docset. It changes whenever the docset's documents change.
+	Mtime int64 `json:"mtime"`
 }
 
 func (d Docset) FullName() string {
@@ -14,3 +17,27 @@ func (d Docset) FullName() string {
 
 	return d.Name + " " + d.Release
 }
+
+// IsOutdated reports whether other is a newer build of the same docset,
+// according to its release and modification time.
+func (d Docset) IsOutdated(other Docset) bool {
+	return d.Release != other.Release || d.Mtime < other.Mtime
+}
+
+// DocsetChange describes a change to the docsets installed on disk.
+type DocsetChange struct {
+	Action   DocsetAction `json:"action"`
+	Slug     string       `json:"slug"`
+	Previous *Docset      `json:"previous"`
+	Current  *Docset      `json:"current"`
+}
+
+type DocsetAction string
+
+const (
+	DocsetInstalled   DocsetAction = "installed"
+	DocsetUpdated     DocsetAction = "updated"
+	DocsetUnchanged   DocsetAction = "unchanged"
+	DocsetUninstalled DocsetAction = "uninstalled"
+	DocsetRolledBack  DocsetAction = "rolled-back"
+)
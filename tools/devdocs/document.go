@@ -7,18 +7,44 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// DocumentContent is the content of a document. It may be compressed, as it
+// is when read from the cache, and is decompressed when read.
 type DocumentContent []byte
 
 func (d DocumentContent) MarshalJSON() ([]byte, error) {
-	return json.Marshal(string(d))
+	data, err := d.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(string(data))
+}
+
+// Bytes returns the uncompressed content.
+func (d DocumentContent) Bytes() ([]byte, error) {
+	return decompress(d)
 }
 
 func (d DocumentContent) Reader() io.Reader {
-	return bytes.NewReader(d)
+	data, err := d.Bytes()
+	if err != nil {
+		return &errReader{err}
+	}
+
+	return bytes.NewReader(data)
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
 }
 
 type document struct {
@@ -32,79 +58,73 @@ type LineRange struct {
 	End   int `json:"end"`
 }
 
+// DocumentSection is a heading of a document and the lines it spans, or a
+// fragment (see [FragmentAnchor]), which has a level of 0. Headings that had
+// no anchor have an empty id.
 type DocumentSection struct {
 	Level int       `json:"level"`
 	ID    string    `json:"id"`
+	Title string    `json:"title"`
 	Lines LineRange `json:"lines"`
 }
 
+func (s DocumentSection) IsFragment() bool {
+	return s.Level == 0
+}
+
 type DocumentIndex struct {
-	IDs    []string
-	Ranges map[string]LineRange
+	// Sections are in the order they appear in the document.
+	Sections []DocumentSection
+	Ranges   map[string]LineRange
 }
 
 func NewDocumentIndex(sections []*DocumentSection) *DocumentIndex {
 	idx := &DocumentIndex{
-		IDs:    make([]string, 0, len(sections)),
-		Ranges: make(map[string]LineRange),
+		Sections: make([]DocumentSection, 0, len(sections)),
+		Ranges:   make(map[string]LineRange),
 	}
 
 	for _, s := range sections {
-		if s.ID == "" {
-			continue
-		}
-
-		idx.IDs = append(idx.IDs, s.ID)
-		idx.Ranges[s.ID] = s.Lines
+		idx.add(*s)
 	}
 
 	return idx
 }
 
-func BuildDocumentIndex(md []byte, ids []string) (*DocumentIndex, error) {
-	sections := make([]*DocumentSection, 0, len(ids))
-	scanner := bufio.NewScanner(bytes.NewReader(md))
-
-	i := 0
-	lineno := 0
-	for scanner.Scan() {
-		lineno++
-		line := scanner.Text()
-
-		// Skip non-heading lines.
-		if !strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Count leading '#' characters.
-		var lvl int
-		for line[lvl] == '#' {
-			lvl++
-		}
-
-		// Skip H1s.
-		if lvl == 1 {
-			continue
-		}
+func (d *DocumentIndex) add(s DocumentSection) {
+	d.Sections = append(d.Sections, s)
+	if s.ID != "" {
+		d.Ranges[s.ID] = s.Lines
+	}
+}
 
+// BuildDocumentIndex finds the sections of a Markdown document, and the line
+// ranges they span. Each section runs until the next heading of the same or
+// a higher level. Sections get their ids from the anchors of the HTML the
+// Markdown was converted from (see [alignHeadings]). Fragments are indexed
+// too, unless a section has the same id. Those without an end run until the
+// next section or fragment.
+func BuildDocumentIndex(md []byte, anchors []HeadingAnchor, fragments []FragmentAnchor) (*DocumentIndex, error) {
+	headings := markdownHeadings(md)
+	ids := alignHeadings(headings, anchors)
+
+	sections := make([]*DocumentSection, 0, len(headings))
+	for i, h := range headings {
 		s := &DocumentSection{
-			Level: lvl,
+			Level: h.Level,
 			ID:    ids[i],
+			Title: h.Text,
 			Lines: LineRange{
-				Start: lineno,
+				Start: h.Line,
 				End:   -1,
 			},
 		}
 
 		slog.Debug("found section", "level", s.Level, "id", s.ID, "line", s.Lines.Start)
-
 		sections = append(sections, s)
-		i++
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
-	}
+	lineno := countLines(md)
 
 	slog.Debug("calculating section ranges", "count", len(sections))
 	stack := newStack[*DocumentSection]()
@@ -141,10 +161,60 @@ func BuildDocumentIndex(md []byte, ids []string) (*DocumentIndex, error) {
 	}
 
 	idx := NewDocumentIndex(sections)
+	// Fragments with the id of a section or of an earlier fragment are left
+	// out, and don't end the fragments before them either.
+	kept := make([]FragmentAnchor, 0, len(fragments))
+	seen := make(map[string]bool)
+	for _, f := range fragments {
+		if _, ok := idx.Ranges[f.ID]; ok || seen[f.ID] {
+			continue
+		}
+
+		seen[f.ID] = true
+		kept = append(kept, f)
+	}
+
+	for _, f := range kept {
+		if f.Lines.End < 0 {
+			f.Lines.End = nextAnchorLine(sections, kept, f.Lines.Start, lineno+1) - 1
+		}
+
+		// Empty elements are named after the content they mark.
+		if f.Title == "" {
+			f.Title = fragmentTitle(lineText(md, f.Lines.Start))
+		}
+
+		slog.Debug("found fragment", "id", f.ID, "start", f.Lines.Start, "end", f.Lines.End)
+		idx.add(DocumentSection{ID: f.ID, Title: f.Title, Lines: f.Lines})
+	}
+
+	sort.SliceStable(idx.Sections, func(i, j int) bool {
+		return idx.Sections[i].Lines.Start < idx.Sections[j].Lines.Start
+	})
+
 	slog.Debug("created document index", "count", idx.Count())
 	return idx, nil
 }
 
+// nextAnchorLine returns the first line after line that a section or
+// fragment starts on, or def if there is none.
+func nextAnchorLine(sections []*DocumentSection, fragments []FragmentAnchor, line int, def int) int {
+	next := def
+	for _, s := range sections {
+		if s.Lines.Start > line {
+			next = min(next, s.Lines.Start)
+		}
+	}
+
+	for _, f := range fragments {
+		if f.Lines.Start > line {
+			next = min(next, f.Lines.Start)
+		}
+	}
+
+	return next
+}
+
 // Get implements the Get method of the [Index] interface.
 func (d *DocumentIndex) Get(id string) (lines *LineRange, ok bool) {
 	r, ok := d.Ranges[id]
@@ -155,13 +225,113 @@ func (d *DocumentIndex) Get(id string) (lines *LineRange, ok bool) {
 	return lines, ok
 }
 
+// Section returns the section with the given id.
+func (d *DocumentIndex) Section(id string) (section DocumentSection, ok bool) {
+	if id == "" {
+		return section, false
+	}
+
+	for _, s := range d.Sections {
+		if s.ID == id {
+			return s, true
+		}
+	}
+
+	return section, false
+}
+
+// FindSection finds the section that query refers to: the section with that
+// id, or else the section whose title best matches it (see
+// [SearchQuery.Score]). Earlier sections win ties.
+func (d *DocumentIndex) FindSection(query string) (section DocumentSection, ok bool) {
+	if s, ok := d.Section(query); ok {
+		return s, true
+	}
+
+	q := NewSearchQuery(query)
+	best := -1
+	for _, s := range d.Sections {
+		score, match := q.Score(s.Title)
+		if match && score > best {
+			section, best, ok = s, score, true
+		}
+	}
+
+	return section, ok
+}
+
+// Shallow returns the lines of a section up to its first subsection.
+func (d *DocumentIndex) Shallow(section DocumentSection) LineRange {
+	lines := section.Lines
+	for _, s := range d.Sections {
+		if !s.IsFragment() && s.Lines.Start > lines.Start && s.Lines.Start <= lines.End {
+			lines.End = s.Lines.Start - 1
+			break
+		}
+	}
+
+	return lines
+}
+
+// Breadcrumbs returns the titles of the headings that section is nested
+// under, outermost first, starting with the title of the document (its first
+// h1) even when the section is not under it. The section itself is left out.
+func (d *DocumentIndex) Breadcrumbs(section DocumentSection) []string {
+	var title string
+	for _, s := range d.Sections {
+		if s.Level == 1 {
+			title = s.Title
+			break
+		}
+	}
+
+	// Walk the headings the way [BuildDocumentIndex] does, so the stack holds
+	// the ancestors of each section as it is reached.
+	stack := newStack[DocumentSection]()
+	var found bool
+	for _, s := range d.Sections {
+		for !s.IsFragment() && stack.Len() > 0 && stack.Top().Level >= s.Level {
+			stack.Pop()
+		}
+
+		if s.Lines.Start == section.Lines.Start && s.Level == section.Level && s.ID == section.ID {
+			found = true
+			break
+		}
+
+		if !s.IsFragment() {
+			stack.Push(s)
+		}
+	}
+
+	crumbs := make([]string, 0, stack.Len()+1)
+	var ancestors []DocumentSection
+	if found {
+		ancestors = stack.Values()
+	}
+
+	if title != "" && section.Level != 1 && (len(ancestors) == 0 || ancestors[0].Level != 1) {
+		crumbs = append(crumbs, title)
+	}
+
+	for _, s := range ancestors {
+		crumbs = append(crumbs, s.Title)
+	}
+
+	return crumbs
+}
+
 // MarshalText implements the MarshalText method of the [Index] interface.
+// Each section is written on a line of its own, as
+//
+//	<start>:<end> <level> <id> <title>
+//
+// where the id may be empty.
 func (d *DocumentIndex) MarshalText() (text []byte, err error) {
 	buf := new(bytes.Buffer)
 
-	for _, id := range d.IDs {
-		l := d.Ranges[id]
-		fmt.Fprintf(buf, "%d:%d %s\n", l.Start, l.End, id)
+	for _, s := range d.Sections {
+		fmt.Fprintf(buf, "%d:%d %d %s %s\n", s.Lines.Start, s.Lines.End, s.Level, s.ID, s.Title)
 	}
 
 	return buf.Bytes(), nil
@@ -169,8 +339,7 @@ func (d *DocumentIndex) MarshalText() (text []byte, err error) {
 
 // UnmarshalText implements the UnmarshalText method of the [Index] interface.
 func (d *DocumentIndex) UnmarshalText(text []byte) error {
-	ids := make([]string, 0)
-	ranges := make(map[string]LineRange)
+	idx := NewDocumentIndex(nil)
 	scanner := bufio.NewScanner(bytes.NewReader(text))
 
 	var n int
@@ -183,9 +352,19 @@ func (d *DocumentIndex) UnmarshalText(text []byte) error {
 			continue
 		}
 
-		rawRange, id, ok := strings.Cut(line, " ")
+		rawRange, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return NewErrBadIndexFormat(n, "no space after range (expected format <start>:<end> <level> <id> <title>)")
+		}
+
+		rawLevel, rest, ok := strings.Cut(rest, " ")
+		if !ok {
+			return NewErrBadIndexFormat(n, "no space after level (expected format <start>:<end> <level> <id> <title>)")
+		}
+
+		id, title, ok := strings.Cut(rest, " ")
 		if !ok {
-			return NewErrBadIndexFormat(n, "no space after range (expected format <start>:<end> <id>)")
+			return NewErrBadIndexFormat(n, "no space after id (expected format <start>:<end> <level> <id> <title>)")
 		}
 
 		rawStart, rawEnd, ok := strings.Cut(rawRange, ":")
@@ -203,25 +382,33 @@ func (d *DocumentIndex) UnmarshalText(text []byte) error {
 			return NewErrBadIndexFormat(n, "bad range syntax : <end> must be a number")
 		}
 
-		ids = append(ids, id)
-		ranges[id] = LineRange{
-			Start: start,
-			End:   end,
+		level, err := strconv.Atoi(rawLevel)
+		if err != nil {
+			return NewErrBadIndexFormat(n, "bad level syntax: <level> must be a number")
 		}
+
+		idx.add(DocumentSection{
+			Level: level,
+			ID:    id,
+			Title: title,
+			Lines: LineRange{
+				Start: start,
+				End:   end,
+			},
+		})
 	}
 
 	if err := scanner.Err(); err != nil {
 		return err
 	}
 
-	d.IDs = ids
-	d.Ranges = ranges
+	*d = *idx
 
 	return nil
 }
 
 func (d *DocumentIndex) Count() int {
-	return len(d.IDs)
+	return len(d.Sections)
 }
 
 // HTMLDocument is the HTML documentation for an entry, as retrieved from the
@@ -242,7 +429,7 @@ func NewHTMLDocument(docset string, entry EntryLocator, content []byte) *HTMLDoc
 
 type MarkdownDocument struct {
 	document
-	Index Index[*LineRange]
+	Index *DocumentIndex
 }
 
 func NewMarkdownDocument(docset string, entry EntryLocator, content []byte, idx *DocumentIndex) *MarkdownDocument {
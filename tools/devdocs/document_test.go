@@ -0,0 +1,331 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildDocumentIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		md        string
+		anchors   []HeadingAnchor
+		fragments []FragmentAnchor
+		want      []DocumentSection
+	}{
+		{
+			name: "nested sections",
+			md:   "# Doc\n\nintro\n\n## One\n\n### One a\n\ntext\n\n## Two\n\ntext\n",
+			anchors: []HeadingAnchor{
+				{Level: 1, ID: "doc", Text: "Doc"},
+				{Level: 2, ID: "one", Text: "One"},
+				{Level: 3, ID: "one-a", Text: "One a"},
+				{Level: 2, ID: "two", Text: "Two"},
+			},
+			want: []DocumentSection{
+				{Level: 1, ID: "doc", Title: "Doc", Lines: LineRange{Start: 1, End: 13}},
+				{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 5, End: 10}},
+				{Level: 3, ID: "one-a", Title: "One a", Lines: LineRange{Start: 7, End: 10}},
+				{Level: 2, ID: "two", Title: "Two", Lines: LineRange{Start: 11, End: 13}},
+			},
+		},
+		{
+			name: "code that looks like headings",
+			md:   "## One\n\n```\n# comment\n## comment\n```\n\n    # indented\n\n## Two\n",
+			anchors: []HeadingAnchor{
+				{Level: 2, ID: "one", Text: "One"},
+				{Level: 2, ID: "two", Text: "Two"},
+			},
+			want: []DocumentSection{
+				{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 1, End: 9}},
+				{Level: 2, ID: "two", Title: "Two", Lines: LineRange{Start: 10, End: 10}},
+			},
+		},
+		{
+			name: "setext headings",
+			md:   "Doc\n===\n\nOne\n---\n\ntext\n",
+			anchors: []HeadingAnchor{
+				{Level: 1, ID: "doc", Text: "Doc"},
+				{Level: 2, ID: "one", Text: "One"},
+			},
+			want: []DocumentSection{
+				{Level: 1, ID: "doc", Title: "Doc", Lines: LineRange{Start: 1, End: 7}},
+				{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 4, End: 7}},
+			},
+		},
+		{
+			name: "more HTML headings than Markdown headings",
+			md:   "## One\n\n## Three\n",
+			anchors: []HeadingAnchor{
+				{Level: 1, ID: "doc", Text: "Doc"},
+				{Level: 2, ID: "one", Text: "One"},
+				{Level: 2, ID: "two", Text: ""},
+				{Level: 2, ID: "three", Text: "Three"},
+			},
+			want: []DocumentSection{
+				{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 1, End: 2}},
+				{Level: 2, ID: "three", Title: "Three", Lines: LineRange{Start: 3, End: 3}},
+			},
+		},
+		{
+			name: "more Markdown headings than HTML headings",
+			md:   "## One\n\n## Two\n\n## Three\n",
+			anchors: []HeadingAnchor{
+				{Level: 2, ID: "three", Text: "Three"},
+			},
+			want: []DocumentSection{
+				{Level: 2, ID: "", Title: "One", Lines: LineRange{Start: 1, End: 2}},
+				{Level: 2, ID: "", Title: "Two", Lines: LineRange{Start: 3, End: 4}},
+				{Level: 2, ID: "three", Title: "Three", Lines: LineRange{Start: 5, End: 5}},
+			},
+		},
+		{
+			name: "fragments",
+			md:   "## One\n\nlen(s)\n\nmark\n\nmore\n\n## Two\n",
+			anchors: []HeadingAnchor{
+				{Level: 2, ID: "one", Text: "One"},
+				{Level: 2, ID: "two", Text: "Two"},
+			},
+			fragments: []FragmentAnchor{
+				{ID: "len", Title: "len(s)", Lines: LineRange{Start: 3, End: 3}},
+				{ID: "mark", Lines: LineRange{Start: 5, End: -1}},
+				{ID: "one", Title: "shadowed", Lines: LineRange{Start: 7, End: 7}},
+			},
+			want: []DocumentSection{
+				{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 1, End: 8}},
+				{Level: 0, ID: "len", Title: "len(s)", Lines: LineRange{Start: 3, End: 3}},
+				{Level: 0, ID: "mark", Title: "mark", Lines: LineRange{Start: 5, End: 8}},
+				{Level: 2, ID: "two", Title: "Two", Lines: LineRange{Start: 9, End: 9}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, err := BuildDocumentIndex([]byte(tt.md), tt.anchors, tt.fragments)
+			if err != nil {
+				t.Fatalf("BuildDocumentIndex() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(idx.Sections, tt.want) {
+				t.Errorf("BuildDocumentIndex() sections = %+v, want %+v", idx.Sections, tt.want)
+			}
+
+			for _, s := range tt.want {
+				if s.ID == "" {
+					continue
+				}
+
+				lines, ok := idx.Get(s.ID)
+				if !ok || *lines != s.Lines {
+					t.Errorf("Get(%q) = %v, %v, want %v", s.ID, lines, ok, s.Lines)
+				}
+			}
+		})
+	}
+}
+
+func TestDocumentIndexText(t *testing.T) {
+	idx := NewDocumentIndex([]*DocumentSection{
+		{Level: 1, ID: "", Title: "Package fmt", Lines: LineRange{Start: 1, End: 30}},
+		{Level: 2, ID: "Printf", Title: "func Printf", Lines: LineRange{Start: 5, End: 20}},
+		{Level: 0, ID: "dt-one", Title: "one: two  three", Lines: LineRange{Start: 8, End: 9}},
+		{Level: 2, ID: "empty-title", Title: "", Lines: LineRange{Start: 21, End: 30}},
+	})
+
+	text, err := idx.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() error = %v", err)
+	}
+
+	got := new(DocumentIndex)
+	if err := got.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, idx) {
+		t.Errorf("UnmarshalText(MarshalText()) = %+v, want %+v", got, idx)
+	}
+}
+
+func TestDocumentIndexUnmarshalTextErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "no level", text: "1:2\n"},
+		{name: "no id", text: "1:2 2\n"},
+		{name: "bad range", text: "1-2 2 id title\n"},
+		{name: "bad start", text: "a:2 2 id title\n"},
+		{name: "bad end", text: "1:b 2 id title\n"},
+		{name: "bad level", text: "1:2 x id title\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := new(DocumentIndex).UnmarshalText([]byte(tt.text))
+			if _, ok := err.(*ErrBadIndexFormat); !ok {
+				t.Errorf("UnmarshalText() error = %v, want *ErrBadIndexFormat", err)
+			}
+		})
+	}
+}
+
+func TestConvertFragments(t *testing.T) {
+	const src = `<h2 id="one">One</h2>
+<p>intro</p>
+<a id="mark"></a>
+<p>after mark</p>
+<p>more<span id="blank"> </span></p>
+<p id="dup">first</p>
+<p id="dup">second</p>
+<p id="one">shadowed</p>
+<h2 id="two">Two</h2>
+<p>end</p>`
+
+	// Empty elements leave nothing behind in the Markdown and run until
+	// the next anchor. Of elements that share an id, the first one wins,
+	// and headings win over everything else.
+	const wantMarkdown = "## One\n\nintro\n\nafter mark\n\nmore\n\nfirst\n\nsecond\n\nshadowed\n\n## Two\n\nend\n"
+	want := []DocumentSection{
+		{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 1, End: 14}},
+		{Level: 0, ID: "mark", Title: "after mark", Lines: LineRange{Start: 5, End: 6}},
+		{Level: 0, ID: "blank", Title: "more", Lines: LineRange{Start: 7, End: 8}},
+		{Level: 0, ID: "dup", Title: "first", Lines: LineRange{Start: 9, End: 9}},
+		{Level: 2, ID: "two", Title: "Two", Lines: LineRange{Start: 15, End: 17}},
+	}
+
+	doc, err := NewMarkdownConverter().Convert(NewHTMLDocument("test", NewEntryLocator("test"), []byte(src)))
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	if got := string(doc.Content); got != wantMarkdown {
+		t.Errorf("Convert() content = %q, want %q", got, wantMarkdown)
+	}
+
+	if !reflect.DeepEqual(doc.Index.Sections, want) {
+		t.Errorf("Convert() sections = %+v, want %+v", doc.Index.Sections, want)
+	}
+}
+
+// testDocumentIndex is the index of a document with nested sections and a
+// fragment:
+//
+//	1-30  # Doc
+//	3-12    ## A
+//	5-6       frag
+//	8-12      ### A1
+//	13-30   ## B
+//	20-30     ### B1
+func testDocumentIndex() *DocumentIndex {
+	return NewDocumentIndex([]*DocumentSection{
+		{Level: 1, ID: "doc", Title: "Doc", Lines: LineRange{Start: 1, End: 30}},
+		{Level: 2, ID: "a", Title: "A", Lines: LineRange{Start: 3, End: 12}},
+		{Level: 0, ID: "frag", Title: "frag", Lines: LineRange{Start: 5, End: 6}},
+		{Level: 3, ID: "a1", Title: "A1", Lines: LineRange{Start: 8, End: 12}},
+		{Level: 2, ID: "b", Title: "B", Lines: LineRange{Start: 13, End: 30}},
+		{Level: 3, ID: "b1", Title: "B1", Lines: LineRange{Start: 20, End: 30}},
+	})
+}
+
+func TestDocumentIndexShallow(t *testing.T) {
+	tests := []struct {
+		id   string
+		want LineRange
+	}{
+		{id: "doc", want: LineRange{Start: 1, End: 2}},
+		{id: "a", want: LineRange{Start: 3, End: 7}},
+		{id: "frag", want: LineRange{Start: 5, End: 6}},
+		{id: "a1", want: LineRange{Start: 8, End: 12}},
+		{id: "b", want: LineRange{Start: 13, End: 19}},
+		{id: "b1", want: LineRange{Start: 20, End: 30}},
+	}
+
+	idx := testDocumentIndex()
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			s, ok := idx.Section(tt.id)
+			if !ok {
+				t.Fatalf("Section(%q) not found", tt.id)
+			}
+
+			if got := idx.Shallow(s); got != tt.want {
+				t.Errorf("Shallow(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentIndexBreadcrumbs(t *testing.T) {
+	tests := []struct {
+		name    string
+		idx     *DocumentIndex
+		section DocumentSection
+		want    []string
+	}{
+		{
+			name:    "document title",
+			idx:     testDocumentIndex(),
+			section: DocumentSection{Level: 1, ID: "doc", Lines: LineRange{Start: 1, End: 30}},
+			want:    []string{},
+		},
+		{
+			name:    "section",
+			idx:     testDocumentIndex(),
+			section: DocumentSection{Level: 2, ID: "a", Lines: LineRange{Start: 3, End: 12}},
+			want:    []string{"Doc"},
+		},
+		{
+			name:    "subsection",
+			idx:     testDocumentIndex(),
+			section: DocumentSection{Level: 3, ID: "b1", Lines: LineRange{Start: 20, End: 30}},
+			want:    []string{"Doc", "B"},
+		},
+		{
+			name:    "fragment",
+			idx:     testDocumentIndex(),
+			section: DocumentSection{Level: 0, ID: "frag", Lines: LineRange{Start: 5, End: 6}},
+			want:    []string{"Doc", "A"},
+		},
+		{
+			name:    "after a fragment",
+			idx:     testDocumentIndex(),
+			section: DocumentSection{Level: 3, ID: "a1", Lines: LineRange{Start: 8, End: 12}},
+			want:    []string{"Doc", "A"},
+		},
+		{
+			name:    "not in the index",
+			idx:     testDocumentIndex(),
+			section: DocumentSection{Level: 2, ID: "missing", Lines: LineRange{Start: 40, End: 41}},
+			want:    []string{"Doc"},
+		},
+		{
+			name: "before the title",
+			idx: NewDocumentIndex([]*DocumentSection{
+				{Level: 2, ID: "intro", Title: "Intro", Lines: LineRange{Start: 1, End: 2}},
+				{Level: 1, ID: "doc", Title: "Doc", Lines: LineRange{Start: 3, End: 10}},
+				{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 5, End: 10}},
+			}),
+			section: DocumentSection{Level: 2, ID: "intro", Lines: LineRange{Start: 1, End: 2}},
+			want:    []string{"Doc"},
+		},
+		{
+			name: "no title",
+			idx: NewDocumentIndex([]*DocumentSection{
+				{Level: 2, ID: "one", Title: "One", Lines: LineRange{Start: 1, End: 10}},
+				{Level: 3, ID: "two", Title: "Two", Lines: LineRange{Start: 3, End: 10}},
+			}),
+			section: DocumentSection{Level: 3, ID: "two", Lines: LineRange{Start: 3, End: 10}},
+			want:    []string{"One"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.idx.Breadcrumbs(tt.section); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Breadcrumbs(%q) = %q, want %q", tt.section.ID, got, tt.want)
+			}
+		})
+	}
+}
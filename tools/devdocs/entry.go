@@ -3,8 +3,10 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 )
 
@@ -66,6 +68,27 @@ func (e *EntryIndex) Get(path string) (entry *Entry, ok bool) {
 	return entry, ok
 }
 
+// FindDocument finds the document at path, which may be the path of an entry
+// or the document of entries that point at its fragments. Fragments of path
+// are ignored.
+func (e *EntryIndex) FindDocument(path string) (loc EntryLocator, ok bool) {
+	loc = NewEntryLocator(path)
+	loc.Fragment = ""
+	if entry, ok := e.Get(loc.Path); ok {
+		loc = NewEntryLocator(entry.Path)
+		loc.Fragment = ""
+		return loc, true
+	}
+
+	for _, p := range e.paths {
+		if NewEntryLocator(p).Path == loc.Path {
+			return loc, true
+		}
+	}
+
+	return loc, false
+}
+
 // MarshalText implements the MarshalText method of the [Index] interface.
 func (e *EntryIndex) MarshalText() (text []byte, err error) {
 	buf := new(bytes.Buffer)
@@ -153,15 +176,80 @@ func (e EntryLocator) String() string {
 	return s
 }
 
+// Permalink returns the URL of an entry on devdocs.io.
+func Permalink(docset string, loc EntryLocator) string {
+	u := mustParseURL(DefaultDevDocsURL).JoinPath(docset, loc.Path)
+	u.Fragment = loc.Fragment
+	return u.String()
+}
+
+// EntryView is what to show of a document: all of it, or excerpts of its
+// sections.
 type EntryView struct {
-	Lines    *LineRange
+	// Sections are the sections an excerpt was made from, in document order.
+	Sections []ExcerptSection
+	// Ranges are the ranges of lines in the excerpt. Overlapping and
+	// adjacent sections are merged into one range.
+	Ranges []LineRange
+	// Breadcrumbs are the headings that every section of an excerpt is
+	// nested under (see [DocumentIndex.Breadcrumbs]).
+	Breadcrumbs []string
+	// Header prints the breadcrumbs of each range of an excerpt above it.
+	Header   bool
 	Document *MarkdownDocument
 }
 
-func NewExcerptView(doc *MarkdownDocument, lines *LineRange) *EntryView {
+// ExcerptSection is a section of an excerpt, and where it is in the
+// document.
+type ExcerptSection struct {
+	DocumentSection
+	Breadcrumbs []string `json:"breadcrumbs"`
+}
+
+// NewExcerptView creates a view of the lines of sections, in document order.
+func NewExcerptView(doc *MarkdownDocument, sections []DocumentSection) *EntryView {
+	sorted := make([]ExcerptSection, 0, len(sections))
+	for _, s := range sections {
+		sorted = append(sorted, ExcerptSection{
+			DocumentSection: s,
+			Breadcrumbs:     doc.Index.Breadcrumbs(s),
+		})
+	}
+
+	slices.SortStableFunc(sorted, func(a, b ExcerptSection) int {
+		return cmp.Compare(a.Lines.Start, b.Lines.Start)
+	})
+
+	ranges := make([]LineRange, 0, len(sorted))
+	for _, s := range sorted {
+		if n := len(ranges); n > 0 && s.Lines.Start <= ranges[n-1].End+1 {
+			ranges[n-1].End = max(ranges[n-1].End, s.Lines.End)
+			continue
+		}
+
+		ranges = append(ranges, s.Lines)
+	}
+
+	// The breadcrumbs of the whole excerpt are the ones its sections share.
+	var crumbs []string
+	for i, s := range sorted {
+		if i == 0 {
+			crumbs = s.Breadcrumbs
+			continue
+		}
+
+		n := 0
+		for n < len(crumbs) && n < len(s.Breadcrumbs) && crumbs[n] == s.Breadcrumbs[n] {
+			n++
+		}
+		crumbs = crumbs[:n]
+	}
+
 	return &EntryView{
-		Lines:    lines,
-		Document: doc,
+		Sections:    sorted,
+		Ranges:      ranges,
+		Breadcrumbs: crumbs,
+		Document:    doc,
 	}
 }
 
@@ -172,34 +260,73 @@ func NewDocumentView(doc *MarkdownDocument) *EntryView {
 }
 
 func (e *EntryView) IsExcerpt() bool {
-	return e.Lines != nil
+	return len(e.Ranges) > 0
 }
 
-// WriteTo implements the [io.WriterTo] interface.
+// Lines returns the lines of an excerpt of a single range, or nil for
+// documents and excerpts of several ranges.
+func (e *EntryView) Lines() *LineRange {
+	if len(e.Ranges) != 1 {
+		return nil
+	}
+
+	return &e.Ranges[0]
+}
+
+// header returns the breadcrumbs of the section that starts on line, if
+// headers are enabled and it has any, followed by a blank line.
+func (e *EntryView) header(line int) []byte {
+	if !e.Header {
+		return nil
+	}
+
+	for _, s := range e.Sections {
+		if s.Lines.Start == line && len(s.Breadcrumbs) > 0 {
+			return []byte(strings.Join(s.Breadcrumbs, " › ") + "\n\n")
+		}
+	}
+
+	return nil
+}
+
+// WriteTo implements the [io.WriterTo] interface. Excerpts of several ranges
+// are separated by a blank line. With a header, each range starts with the
+// breadcrumbs of its first section.
 func (e *EntryView) WriteTo(w io.Writer) (n int64, err error) {
 	if !e.IsExcerpt() {
 		return io.Copy(w, e.Document.Content.Reader())
 	} else {
 		scanner := bufio.NewScanner(e.Document.Content.Reader())
-		start := e.Lines.Start
-		end := e.Lines.End
+		ranges := e.Ranges
 
 		var line, lineN int
-		for scanner.Scan() {
+		var written, lastBlank bool
+		for len(ranges) > 0 && scanner.Scan() {
 			line++
 
-			if line < start {
+			if line < ranges[0].Start {
 				continue
-			} else if line > end {
-				break
 			}
 
 			b := append(scanner.Bytes(), '\n')
+			if line == ranges[0].Start {
+				b = append(e.header(line), b...)
+				if written && !lastBlank {
+					b = append([]byte{'\n'}, b...)
+				}
+			}
+
 			lineN, err = w.Write(b)
 			n += int64(lineN)
 			if err != nil {
 				return n, err
 			}
+
+			written = true
+			lastBlank = len(bytes.TrimSpace(scanner.Bytes())) == 0
+			if line >= ranges[0].End {
+				ranges = ranges[1:]
+			}
 		}
 
 		if err := scanner.Err(); err != nil {
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewExcerptView(t *testing.T) {
+	tests := []struct {
+		name       string
+		ids        []string
+		sections   []DocumentSection
+		wantIDs    []string
+		wantRanges []LineRange
+		wantCrumbs []string
+		wantSingle bool
+	}{
+		{
+			name:       "single section",
+			ids:        []string{"a"},
+			wantIDs:    []string{"a"},
+			wantRanges: []LineRange{{Start: 3, End: 12}},
+			wantCrumbs: []string{"Doc"},
+			wantSingle: true,
+		},
+		{
+			name:       "overlapping",
+			ids:        []string{"a1", "a"},
+			wantIDs:    []string{"a", "a1"},
+			wantRanges: []LineRange{{Start: 3, End: 12}},
+			wantCrumbs: []string{"Doc"},
+			wantSingle: true,
+		},
+		{
+			name:       "nested in a section",
+			ids:        []string{"frag", "a1"},
+			wantIDs:    []string{"frag", "a1"},
+			wantRanges: []LineRange{{Start: 5, End: 6}, {Start: 8, End: 12}},
+			wantCrumbs: []string{"Doc", "A"},
+		},
+		{
+			name:       "adjacent",
+			ids:        []string{"b", "a"},
+			wantIDs:    []string{"a", "b"},
+			wantRanges: []LineRange{{Start: 3, End: 30}},
+			wantCrumbs: []string{"Doc"},
+			wantSingle: true,
+		},
+		{
+			name:       "disjoint",
+			ids:        []string{"b1", "frag"},
+			wantIDs:    []string{"frag", "b1"},
+			wantRanges: []LineRange{{Start: 5, End: 6}, {Start: 20, End: 30}},
+			wantCrumbs: []string{"Doc"},
+		},
+		{
+			name: "one line apart",
+			sections: []DocumentSection{
+				{ID: "x", Lines: LineRange{Start: 1, End: 2}},
+				{ID: "y", Lines: LineRange{Start: 4, End: 5}},
+			},
+			wantIDs:    []string{"x", "y"},
+			wantRanges: []LineRange{{Start: 1, End: 2}, {Start: 4, End: 5}},
+			wantCrumbs: []string{"Doc"},
+		},
+	}
+
+	idx := testDocumentIndex()
+	doc := NewMarkdownDocument("test", NewEntryLocator("test"), nil, idx)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections := tt.sections
+			for _, id := range tt.ids {
+				s, ok := idx.Section(id)
+				if !ok {
+					t.Fatalf("Section(%q) not found", id)
+				}
+				sections = append(sections, s)
+			}
+
+			view := NewExcerptView(doc, sections)
+
+			var ids []string
+			for _, s := range view.Sections {
+				ids = append(ids, s.ID)
+			}
+
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("NewExcerptView() sections = %q, want %q", ids, tt.wantIDs)
+			}
+
+			if !reflect.DeepEqual(view.Ranges, tt.wantRanges) {
+				t.Errorf("NewExcerptView() ranges = %v, want %v", view.Ranges, tt.wantRanges)
+			}
+
+			if !reflect.DeepEqual(view.Breadcrumbs, tt.wantCrumbs) {
+				t.Errorf("NewExcerptView() breadcrumbs = %q, want %q", view.Breadcrumbs, tt.wantCrumbs)
+			}
+
+			if got := view.Lines() != nil; got != tt.wantSingle {
+				t.Errorf("Lines() != nil is %v, want %v", got, tt.wantSingle)
+			}
+		})
+	}
+}
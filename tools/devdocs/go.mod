@@ -3,16 +3,19 @@ module github.com/cmessinides/dotfiles/tools/devdocs
 go 1.24.5
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/JohannesKaufmann/html-to-markdown/v2 v2.3.3
 	github.com/PuerkitoBio/goquery v1.10.3
 	github.com/alecthomas/kong v1.12.1
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-shellwords v1.0.12
+	github.com/yuin/goldmark v1.7.11
+	golang.org/x/net v0.39.0
 	golang.org/x/term v0.33.0
 )
 
 require (
 	github.com/JohannesKaufmann/dom v0.2.0 // indirect
 	github.com/andybalholm/cascadia v1.3.3 // indirect
-	golang.org/x/net v0.39.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
 )
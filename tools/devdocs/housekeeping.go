@@ -0,0 +1,675 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ResourceInstalled is the files of installed docsets. They are not
+	// resources from DevDocs, but they live in the cache all the same.
+	ResourceInstalled ResourceKind = installedDir
+	// ResourcePrevious is the files of previous installations of docsets.
+	ResourcePrevious ResourceKind = previousDir
+)
+
+// cachedKinds are the kinds of resources that can be pruned. Installed
+// docsets are only ever removed on request.
+var cachedKinds = []ResourceKind{
+	ResourceDocsets,
+	ResourceIndex,
+	ResourceDocument,
+	ResourceMarkdown,
+}
+
+// stagingMaxAge is how old a staging directory for an installation has to be
+// before it is considered abandoned.
+const stagingMaxAge = time.Hour
+
+// rollbackSwapPrefix starts the names of the directories that
+// [Cache.RollbackDocset] swaps installations through. They are never
+// removed as abandoned staging, since a failed rollback can leave the only
+// copy of an installation in one.
+const rollbackSwapPrefix = ".rollback-"
+
+// CacheUsage is the space used by one kind of resource for one docset.
+type CacheUsage struct {
+	Kind   ResourceKind `json:"kind"`
+	Docset string       `json:"docset,omitempty"`
+	Files  int          `json:"files"`
+	Size   int64        `json:"size"`
+	// Uncompressed is the size of the files once decompressed.
+	Uncompressed int64 `json:"uncompressed_size"`
+	// Ratio is how many times smaller the files are compressed.
+	Ratio float64 `json:"compression_ratio"`
+}
+
+// CacheStats describes the contents of the cache.
+type CacheStats struct {
+	Dir          string       `json:"dir"`
+	Size         int64        `json:"size"`
+	Uncompressed int64        `json:"uncompressed_size"`
+	Ratio        float64      `json:"compression_ratio"`
+	Usage        []CacheUsage `json:"usage"`
+}
+
+func compressionRatio(uncompressed int64, size int64) float64 {
+	if size == 0 {
+		return 1
+	}
+
+	return float64(uncompressed) / float64(size)
+}
+
+// CacheCleanup summarizes the files removed from the cache.
+type CacheCleanup struct {
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+}
+
+// CacheRepair is how a corrupt file in the cache was dealt with.
+type CacheRepair string
+
+const (
+	CacheNotRepaired CacheRepair = "none"
+	CacheDeleted     CacheRepair = "deleted"
+	CacheReinstalled CacheRepair = "reinstalled"
+)
+
+// CacheProblem is a corrupt file in the cache. For installed docsets, Path is
+// the directory of the installation.
+type CacheProblem struct {
+	Kind   ResourceKind `json:"kind"`
+	Docset string       `json:"docset,omitempty"`
+	Path   string       `json:"path"`
+	Error  string       `json:"error"`
+	Repair CacheRepair  `json:"repair"`
+}
+
+// cachedFile is a file in the cache. For cached resources, the size includes
+// the metadata sidecar.
+type cachedFile struct {
+	path   string
+	rel    string
+	kind   ResourceKind
+	docset string
+	size   int64
+	// data is the size of the resource alone, without its metadata.
+	data int64
+	used time.Time
+	// orphan is true for resources without metadata and vice versa. The
+	// cache treats them as missing.
+	orphan bool
+}
+
+// files lists the files of one kind in the cache.
+func (c *Cache) files(kind ResourceKind) ([]cachedFile, error) {
+	root := filepath.Join(c.dir, string(kind))
+	files := make([]cachedFile, 0)
+	metas := make(map[string]fs.FileInfo)
+
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && isCacheMiss(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if kind != ResourceInstalled && kind != ResourcePrevious && strings.HasSuffix(p, ".meta") {
+			metas[strings.TrimSuffix(p, ".meta")] = info
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, cachedFile{
+			path:   p,
+			rel:    filepath.ToSlash(rel),
+			kind:   kind,
+			docset: cachedDocset(kind, rel),
+			size:   info.Size(),
+			data:   info.Size(),
+			used:   info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return files, err
+	}
+
+	if kind == ResourceInstalled || kind == ResourcePrevious {
+		return files, nil
+	}
+
+	for i, f := range files {
+		if meta, ok := metas[f.path]; ok {
+			files[i].size += meta.Size()
+			delete(metas, f.path)
+		} else {
+			files[i].orphan = true
+		}
+	}
+
+	for p, meta := range metas {
+		rel, _ := filepath.Rel(root, p)
+		files = append(files, cachedFile{
+			path:   metaPath(p),
+			rel:    filepath.ToSlash(rel) + ".meta",
+			kind:   kind,
+			docset: cachedDocset(kind, rel),
+			size:   meta.Size(),
+			used:   meta.ModTime(),
+			orphan: true,
+		})
+	}
+
+	return files, nil
+}
+
+// cachedDocset returns the slug of the docset a file belongs to, based on its
+// path relative to the directory for its kind.
+func cachedDocset(kind ResourceKind, rel string) string {
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+
+	switch kind {
+	case ResourceIndex, ResourceDocument, ResourceMarkdown:
+		// <remote or fingerprint>/<slug>/...
+		if len(parts) > 2 {
+			return parts[1]
+		}
+	case ResourceInstalled, ResourcePrevious:
+		// <slug>/...
+		if len(parts) > 1 {
+			return parts[0]
+		}
+	}
+
+	return ""
+}
+
+// remove deletes a file and its metadata sidecar.
+func (c *Cache) remove(f cachedFile) error {
+	if err := os.Remove(f.path); err != nil && !isCacheMiss(err) {
+		return err
+	}
+
+	if err := os.Remove(metaPath(f.path)); err != nil && !isCacheMiss(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Stats reports how much space each kind of resource uses per docset.
+func (c *Cache) Stats() (*CacheStats, error) {
+	stats := &CacheStats{
+		Dir:   c.dir,
+		Usage: make([]CacheUsage, 0),
+	}
+
+	unlock, err := c.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	kinds := slices.Concat(cachedKinds, []ResourceKind{ResourceInstalled, ResourcePrevious})
+	for _, kind := range kinds {
+		files, err := c.files(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		usage := make(map[string]*CacheUsage)
+		for _, f := range files {
+			u, ok := usage[f.docset]
+			if !ok {
+				u = &CacheUsage{Kind: kind, Docset: f.docset}
+				usage[f.docset] = u
+			}
+
+			uncompressed := f.size
+			if !strings.HasSuffix(f.path, ".meta") {
+				u.Files++
+				if n, err := uncompressedSize(f.path); err == nil {
+					uncompressed += n - f.data
+				}
+			}
+			u.Size += f.size
+			u.Uncompressed += uncompressed
+			stats.Size += f.size
+			stats.Uncompressed += uncompressed
+		}
+
+		start := len(stats.Usage)
+		for _, u := range usage {
+			u.Ratio = compressionRatio(u.Uncompressed, u.Size)
+			stats.Usage = append(stats.Usage, *u)
+		}
+
+		added := stats.Usage[start:]
+		sort.Slice(added, func(i, j int) bool {
+			return added[i].Docset < added[j].Docset
+		})
+	}
+
+	stats.Ratio = compressionRatio(stats.Uncompressed, stats.Size)
+	return stats, nil
+}
+
+// Prune removes cached resources that can no longer be used, such as
+// Markdown from other versions of the converter, then removes the least
+// recently used resources until the cache fits in maxSize bytes. A maxSize
+// of 0 means no limit. Installed docsets don't count towards the limit.
+func (c *Cache) Prune(maxSize int64, fingerprint string) (CacheCleanup, error) {
+	var cleanup CacheCleanup
+
+	unlock, err := c.lock(true)
+	if err != nil {
+		return cleanup, err
+	}
+	defer unlock()
+
+	remove := func(f cachedFile) error {
+		if err := c.remove(f); err != nil {
+			return err
+		}
+
+		cleanup.Files++
+		cleanup.Size += f.size
+		return nil
+	}
+
+	var size int64
+	keep := make([]cachedFile, 0)
+	for _, kind := range cachedKinds {
+		files, err := c.files(kind)
+		if err != nil {
+			return cleanup, err
+		}
+
+		for _, f := range files {
+			outdated := kind == ResourceMarkdown && !strings.HasPrefix(f.rel, fingerprint+"/")
+			if f.orphan || outdated {
+				if err := remove(f); err != nil {
+					return cleanup, err
+				}
+				continue
+			}
+
+			keep = append(keep, f)
+			size += f.size
+		}
+	}
+
+	if maxSize > 0 && size > maxSize {
+		sort.Slice(keep, func(i, j int) bool {
+			return keep[i].used.Before(keep[j].used)
+		})
+
+		for _, f := range keep {
+			if size <= maxSize {
+				break
+			}
+
+			if err := remove(f); err != nil {
+				return cleanup, err
+			}
+			size -= f.size
+		}
+	}
+
+	if err := c.removeAbandonedStaging(&cleanup); err != nil {
+		return cleanup, err
+	}
+
+	for _, kind := range cachedKinds {
+		if err := removeEmptyDirs(filepath.Join(c.dir, string(kind))); err != nil {
+			return cleanup, err
+		}
+	}
+
+	return cleanup, nil
+}
+
+// removeAbandonedStaging removes the staging directories of installations
+// that were interrupted.
+func (c *Cache) removeAbandonedStaging(cleanup *CacheCleanup) error {
+	files, err := c.files(ResourceInstalled)
+	if err != nil {
+		return err
+	}
+
+	abandoned := make(map[string]bool)
+	for _, f := range files {
+		if !strings.HasPrefix(f.docset, ".") || strings.HasPrefix(f.docset, rollbackSwapPrefix) || time.Since(f.used) < stagingMaxAge {
+			continue
+		}
+
+		abandoned[f.docset] = true
+		cleanup.Files++
+		cleanup.Size += f.size
+	}
+
+	for dir := range abandoned {
+		if err := os.RemoveAll(filepath.Join(c.dir, installedDir, dir)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeEmptyDirs removes every empty directory under root, but not root
+// itself.
+func removeEmptyDirs(root string) error {
+	dirs := make([]string, 0)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && isCacheMiss(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if d.IsDir() && p != root {
+			dirs = append(dirs, p)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove the deepest directories first, so their parents can be empty.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dirents, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return err
+		}
+
+		if len(dirents) == 0 {
+			if err := os.Remove(dirs[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Clear removes every cached resource. If all is true, installed docsets are
+// removed as well.
+func (c *Cache) Clear(all bool) (CacheCleanup, error) {
+	var cleanup CacheCleanup
+
+	unlock, err := c.lock(true)
+	if err != nil {
+		return cleanup, err
+	}
+	defer unlock()
+
+	kinds := cachedKinds
+	if all {
+		kinds = slices.Concat(kinds, []ResourceKind{ResourceInstalled, ResourcePrevious})
+	}
+
+	for _, kind := range kinds {
+		files, err := c.files(kind)
+		if err != nil {
+			return cleanup, err
+		}
+
+		if err := os.RemoveAll(filepath.Join(c.dir, string(kind))); err != nil {
+			return cleanup, err
+		}
+
+		for _, f := range files {
+			if !strings.HasSuffix(f.path, ".meta") {
+				cleanup.Files++
+			}
+			cleanup.Size += f.size
+		}
+	}
+
+	return cleanup, nil
+}
+
+// Verify checks that every file in the cache can be read back: that cached
+// resources have valid metadata, that JSON resources and document indexes
+// parse, and that installed docsets are complete.
+func (c *Cache) Verify() ([]CacheProblem, error) {
+	problems := make([]CacheProblem, 0)
+
+	unlock, err := c.lock(false)
+	if err != nil {
+		return problems, err
+	}
+	defer unlock()
+
+	for _, kind := range cachedKinds {
+		files, err := c.files(kind)
+		if err != nil {
+			return problems, err
+		}
+
+		for _, f := range files {
+			if err := verifyCachedFile(f); err != nil {
+				problems = append(problems, CacheProblem{
+					Kind:   kind,
+					Docset: f.docset,
+					Path:   f.path,
+					Error:  err.Error(),
+					Repair: CacheNotRepaired,
+				})
+			}
+		}
+	}
+
+	for _, kind := range []ResourceKind{ResourceInstalled, ResourcePrevious} {
+		dirents, err := os.ReadDir(filepath.Join(c.dir, string(kind)))
+		if isCacheMiss(err) {
+			continue
+		} else if err != nil {
+			return problems, err
+		}
+
+		for _, d := range dirents {
+			if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+				continue
+			}
+
+			dir := filepath.Join(c.dir, string(kind), d.Name())
+			if err := verifyInstalledDocset(dir); err != nil {
+				problems = append(problems, CacheProblem{
+					Kind:   kind,
+					Docset: d.Name(),
+					Path:   dir,
+					Error:  err.Error(),
+					Repair: CacheNotRepaired,
+				})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// RemoveCorrupt deletes a corrupt file, or installation, found by
+// [Cache.Verify].
+func (c *Cache) RemoveCorrupt(p CacheProblem) error {
+	unlock, err := c.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if p.Kind == ResourceInstalled || p.Kind == ResourcePrevious {
+		return os.RemoveAll(p.Path)
+	}
+
+	return c.remove(cachedFile{path: p.Path})
+}
+
+func verifyCachedFile(f cachedFile) error {
+	if strings.HasSuffix(f.path, ".meta") {
+		return errors.New("resource is missing")
+	}
+
+	if f.orphan {
+		return errors.New("metadata is missing")
+	}
+
+	if _, err := readCacheMeta(f.path); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case f.kind == ResourceDocsets:
+		var list []Docset
+		return json.Unmarshal(data, &list)
+	case f.kind == ResourceIndex:
+		return verifyEntryIndex(data)
+	case f.kind == ResourceMarkdown && strings.HasSuffix(f.path, ".index"):
+		return new(DocumentIndex).UnmarshalText(data)
+	case isDocumentResource(f.kind, filepath.ToSlash(f.path)):
+		_, err := decompress(data)
+		return err
+	default:
+		return nil
+	}
+}
+
+// verifyEntryIndex checks that an index.json can be read, and that its
+// entries make an [EntryIndex] that can be read back, which fails for entries
+// with a blank path or name.
+func verifyEntryIndex(data []byte) error {
+	var m EntryManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	text, err := NewEntryIndex(m.Entries).MarshalText()
+	if err != nil {
+		return err
+	}
+
+	return new(EntryIndex).UnmarshalText(text)
+}
+
+func verifyInstalledDocset(dir string) error {
+	i, err := readInstalledDocset(nil, dir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := i.Manifest(); err != nil {
+		return err
+	}
+
+	db, err := os.ReadFile(filepath.Join(dir, installedDatabase))
+	if err != nil {
+		return err
+	}
+
+	db, err = decompress(db)
+	if err != nil {
+		return fmt.Errorf("could not decompress database of installed docset %q: %w", i.Slug, err)
+	}
+
+	if !json.Valid(db) {
+		return fmt.Errorf("could not parse database of installed docset %q", i.Slug)
+	}
+
+	return nil
+}
+
+// ByteSize is a number of bytes that can be given with a unit, like "500MB"
+// or "2GiB".
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// UnmarshalText implements the [encoding.TextUnmarshaler] interface.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+
+	unit := int64(1)
+	for _, u := range byteUnits {
+		if rest, ok := strings.CutSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)); ok {
+			s = strings.TrimSpace(rest)
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q (expected e.g. 500MB or 2GiB)", string(text))
+	}
+
+	*b = ByteSize(n * float64(unit))
+	return nil
+}
+
+// String implements the [fmt.Stringer] interface.
+func (b ByteSize) String() string {
+	n := float64(b)
+	for _, unit := range []string{"B", "KiB", "MiB"} {
+		if n < 1024 {
+			if unit == "B" {
+				return fmt.Sprintf("%d B", int64(b))
+			}
+
+			return fmt.Sprintf("%.1f %s", n, unit)
+		}
+
+		n /= 1024
+	}
+
+	return fmt.Sprintf("%.1f GiB", n)
+}
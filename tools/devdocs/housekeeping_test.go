@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneKeepsRollbackSwap(t *testing.T) {
+	c := NewCache(t.TempDir(), CacheOptions{})
+
+	// A swap directory left by a rollback that could not be undone holds
+	// the only copy of an installation. A staging directory from an
+	// interrupted install holds nothing of value.
+	swap := filepath.Join(c.Dir(), installedDir, rollbackSwapPrefix+"go-123", "go")
+	staging := filepath.Join(c.Dir(), installedDir, ".go-456")
+	old := time.Now().Add(-2 * stagingMaxAge)
+	for _, dir := range []string{swap, staging} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		p := filepath.Join(dir, installedDatabase)
+		if err := os.WriteFile(p, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.Prune(0, DefaultMarkdownConverter.Fingerprint()); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(swap, installedDatabase)); err != nil {
+		t.Errorf("Prune() removed the rollback swap directory: %v", err)
+	}
+
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("Prune() kept the abandoned staging directory: %v", err)
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotInstalled      = errors.New("docset is not installed")
+	ErrNoPreviousInstall = errors.New("docset has no previous installation")
+	ErrSharedInstall     = errors.New("docset is installed in a read-only shared cache")
+)
+
+const (
+	installedDir      = "installed"
+	previousDir       = "previous"
+	installedMetaFile = "docset.json"
+	installedIndex    = "index.json"
+	installedDatabase = "db.json"
+)
+
+// InstalledDocset is a docset stored on disk in its entirety, so it can be
+// read without the network. It consists of the docset's index.json and
+// db.json, which maps each document path to its HTML.
+type InstalledDocset struct {
+	Docset
+	InstalledAt time.Time `json:"installed_at"`
+	dir         string
+	// cache is locked while reading files, so they are never read in the
+	// middle of an update. It is nil if the caller holds the lock.
+	cache *Cache
+}
+
+func (i *InstalledDocset) lock() (unlock func(), err error) {
+	if i.cache == nil {
+		return func() {}, nil
+	}
+
+	return i.cache.lock(false)
+}
+
+// Index reads the index.json of the installed docset as-is.
+func (i *InstalledDocset) Index() ([]byte, error) {
+	unlock, err := i.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return os.ReadFile(filepath.Join(i.dir, installedIndex))
+}
+
+// Manifest reads the entries of the installed docset.
+func (i *InstalledDocset) Manifest() (EntryManifest, error) {
+	m := EntryManifest{
+		Entries: make([]Entry, 0),
+	}
+
+	data, err := i.Index()
+	if err != nil {
+		return m, err
+	}
+
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return m, fmt.Errorf("could not parse index of installed docset %q: %w", i.Slug, err)
+	}
+
+	m.Docset = i.Slug
+	return m, nil
+}
+
+// GetDocument reads the HTML for an entry from the installed docset. If the
+// docset has no such document, it returns [ErrNotFound].
+func (i *InstalledDocset) GetDocument(entry EntryLocator) (*HTMLDocument, error) {
+	r, err := i.OpenDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	html, ok, err := findDatabaseDocument(r, entry.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read database of installed docset %q: %w", i.Slug, err)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("searched for path %q in installed docset %q: %w", entry.Path, i.Slug, ErrNotFound)
+	}
+
+	return NewHTMLDocument(i.Slug, entry, html), nil
+}
+
+// OpenDatabase opens the db.json of the installed docset, decompressing it as
+// it is read.
+func (i *InstalledDocset) OpenDatabase() (io.ReadCloser, error) {
+	unlock, err := i.lock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Once open, the file can be read even if an update replaces it.
+	f, err := os.Open(filepath.Join(i.dir, installedDatabase))
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := decompressReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not read database of installed docset %q: %w", i.Slug, err)
+	}
+
+	return &databaseReader{ReadCloser: r, f: f}, nil
+}
+
+// databaseReader closes both the decompressor and the file under it.
+type databaseReader struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (r *databaseReader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.f.Close())
+}
+
+// findDatabaseDocument scans a db.json object for the given path. Documents
+// are decoded one at a time, so only the matching one is held in memory.
+func findDatabaseDocument(r io.Reader, path string) ([]byte, bool, error) {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if tok != json.Delim('{') {
+		return nil, false, fmt.Errorf("expected object, got %v", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false, err
+		}
+
+		key, _ := tok.(string)
+		if key == path {
+			var html string
+			if err := dec.Decode(&html); err != nil {
+				return nil, false, err
+			}
+
+			return []byte(html), true, nil
+		}
+
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return nil, false, nil
+}
+
+func (c *Cache) installPath(tree string, slug string) (string, error) {
+	if !isValidSlug(slug) {
+		return "", fmt.Errorf("invalid docset slug %q", slug)
+	}
+
+	return filepath.Join(c.dir, tree, slug), nil
+}
+
+// isValidSlug reports whether slug can safely name a directory.
+func isValidSlug(slug string) bool {
+	return filepath.IsLocal(slug) && !strings.ContainsAny(slug, `/\`) && !strings.HasPrefix(slug, ".")
+}
+
+func readInstalledDocset(c *Cache, dir string) (*InstalledDocset, error) {
+	data, err := os.ReadFile(filepath.Join(dir, installedMetaFile))
+	if err != nil {
+		return nil, err
+	}
+
+	i := &InstalledDocset{dir: dir, cache: c}
+	if err := json.Unmarshal(data, i); err != nil {
+		return nil, fmt.Errorf("could not parse metadata of installed docset in %q: %w", dir, err)
+	}
+
+	return i, nil
+}
+
+// InstalledDocset returns the installed docset with the given slug, from the
+// cache or else one of its shared layers. If the docset is not installed, the
+// returned error satisfies errors.Is(err, fs.ErrNotExist).
+func (c *Cache) InstalledDocset(slug string) (*InstalledDocset, error) {
+	i, err := c.ownInstalledDocset(slug)
+	if !isCacheMiss(err) {
+		return i, err
+	}
+
+	for _, l := range c.shared {
+		i, lerr := l.ownInstalledDocset(slug)
+		if lerr == nil {
+			return i, nil
+		} else if !isCacheMiss(lerr) {
+			slog.Debug("failed to read installed docset from shared cache", "dir", l.dir, "slug", slug, "err", lerr)
+		}
+	}
+
+	return nil, err
+}
+
+// ownInstalledDocset returns a docset installed in the cache itself, as
+// opposed to its shared layers.
+func (c *Cache) ownInstalledDocset(slug string) (*InstalledDocset, error) {
+	unlock, err := c.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return c.installedDocset(installedDir, slug)
+}
+
+// PreviousDocset returns the installation of a docset that was replaced by
+// its most recent update, if any.
+func (c *Cache) PreviousDocset(slug string) (*InstalledDocset, error) {
+	unlock, err := c.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return c.installedDocset(previousDir, slug)
+}
+
+// installedDocset reads an installation without locking the cache.
+func (c *Cache) installedDocset(tree string, slug string) (*InstalledDocset, error) {
+	dir, err := c.installPath(tree, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return readInstalledDocset(c, dir)
+}
+
+// InstalledDocsets returns every installed docset, sorted by slug. Docsets
+// installed in the cache itself take precedence over the shared layers.
+func (c *Cache) InstalledDocsets() ([]*InstalledDocset, error) {
+	list, err := c.ownInstalledDocsets()
+	if err != nil || len(c.shared) == 0 {
+		return list, err
+	}
+
+	seen := make(map[string]bool, len(list))
+	for _, i := range list {
+		seen[i.Slug] = true
+	}
+
+	for _, l := range c.shared {
+		shared, err := l.ownInstalledDocsets()
+		if err != nil {
+			slog.Debug("failed to list installed docsets in shared cache", "dir", l.dir, "err", err)
+			continue
+		}
+
+		for _, i := range shared {
+			if !seen[i.Slug] {
+				list = append(list, i)
+				seen[i.Slug] = true
+			}
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Slug < list[j].Slug
+	})
+
+	return list, nil
+}
+
+func (c *Cache) ownInstalledDocsets() ([]*InstalledDocset, error) {
+	list := make([]*InstalledDocset, 0)
+
+	unlock, err := c.lock(false)
+	if err != nil {
+		return list, err
+	}
+	defer unlock()
+
+	dirents, err := os.ReadDir(filepath.Join(c.dir, installedDir))
+	if isCacheMiss(err) {
+		return list, nil
+	} else if err != nil {
+		return list, err
+	}
+
+	for _, d := range dirents {
+		// Skip files and installations in progress.
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+
+		i, err := c.installedDocset(installedDir, d.Name())
+		if isCacheMiss(err) {
+			continue
+		} else if err != nil {
+			return list, err
+		}
+
+		list = append(list, i)
+	}
+
+	return list, nil
+}
+
+// InstallDocset stores the index.json and db.json of a docset. Any previous
+// installation is kept, so it can be restored with [Cache.RollbackDocset].
+func (c *Cache) InstallDocset(d Docset, index []byte, db []byte) (*InstalledDocset, error) {
+	dir, err := c.installPath(installedDir, d.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	prevDir, err := c.installPath(previousDir, d.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	var m EntryManifest
+	if err := json.Unmarshal(index, &m); err != nil {
+		return nil, fmt.Errorf("could not parse index of docset %q: %w", d.Slug, err)
+	}
+
+	if !json.Valid(db) {
+		return nil, fmt.Errorf("could not parse database of docset %q", d.Slug)
+	}
+
+	db, err = compress(db, c.compression)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &InstalledDocset{
+		Docset:      d,
+		InstalledAt: time.Now(),
+		dir:         dir,
+		cache:       c,
+	}
+
+	meta, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stage the new installation next to the current one, so the current
+	// one stays intact if anything goes wrong.
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return nil, err
+	}
+
+	staging, err := os.MkdirTemp(filepath.Dir(dir), "."+d.Slug+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{installedIndex, index},
+		{installedDatabase, db},
+		{installedMetaFile, meta},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(staging, f.name), f.data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	// The files are staged without a lock, since no one else reads them.
+	// Swapping the installations is only atomic for readers that take one.
+	unlock, err := c.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(dir); err == nil {
+		if err := os.MkdirAll(filepath.Dir(prevDir), 0o755); err != nil {
+			return nil, err
+		}
+
+		if err := os.RemoveAll(prevDir); err != nil {
+			return nil, err
+		}
+
+		if err := os.Rename(dir, prevDir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// notInstalled explains why a docset is not installed in the cache itself,
+// which is the only place it can be changed.
+func (c *Cache) notInstalled(slug string) error {
+	for _, l := range c.shared {
+		if _, err := l.ownInstalledDocset(slug); err == nil {
+			return fmt.Errorf("%w: %s", ErrSharedInstall, l.dir)
+		}
+	}
+
+	return ErrNotInstalled
+}
+
+// UninstallDocset removes a docset, along with its previous installation.
+func (c *Cache) UninstallDocset(slug string) (*InstalledDocset, error) {
+	unlock, err := c.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	i, err := c.installedDocset(installedDir, slug)
+	if isCacheMiss(err) {
+		return nil, c.notInstalled(slug)
+	} else if err != nil {
+		return nil, err
+	}
+
+	prevDir, err := c.installPath(previousDir, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(i.dir); err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(prevDir); err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// RollbackDocset swaps the current installation of a docset with the one it
+// replaced. Rolling back twice restores the original state.
+func (c *Cache) RollbackDocset(slug string) (from *InstalledDocset, to *InstalledDocset, err error) {
+	unlock, err := c.lock(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	from, err = c.installedDocset(installedDir, slug)
+	if isCacheMiss(err) {
+		return nil, nil, c.notInstalled(slug)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	to, err = c.installedDocset(previousDir, slug)
+	if isCacheMiss(err) {
+		return nil, nil, ErrNoPreviousInstall
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	swap, err := os.MkdirTemp(filepath.Dir(from.dir), rollbackSwapPrefix+slug+"-")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rename into a fresh path inside the temporary directory, since a
+	// directory can't be renamed over an existing one.
+	tmp := filepath.Join(swap, slug)
+	steps := [][2]string{
+		{from.dir, tmp},
+		{to.dir, from.dir},
+		{tmp, to.dir},
+	}
+	for i, s := range steps {
+		if err := os.Rename(s[0], s[1]); err != nil {
+			return nil, nil, undoRenames(steps[:i], swap, err)
+		}
+	}
+
+	// The swap directory is only removed once nothing is left in it.
+	if err := os.Remove(swap); err != nil {
+		slog.Debug("failed to remove swap directory", "path", swap, "err", err)
+	}
+
+	from.dir, to.dir = to.dir, from.dir
+	return from, to, nil
+}
+
+// undoRenames reverts renames that were done, in reverse order, after a
+// later one failed with err. The swap directory they went through is removed
+// only if every rename is undone, since it may otherwise hold an install.
+func undoRenames(done [][2]string, swap string, err error) error {
+	for i := len(done) - 1; i >= 0; i-- {
+		s := done[i]
+		if undoErr := os.Rename(s[1], s[0]); undoErr != nil {
+			return fmt.Errorf("%w (could not restore %s from %s: %w)", err, s[0], s[1], undoErr)
+		}
+	}
+
+	if rmErr := os.RemoveAll(swap); rmErr != nil {
+		slog.Debug("failed to remove swap directory", "path", swap, "err", rmErr)
+	}
+
+	return err
+}
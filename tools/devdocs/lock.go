@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// cacheLockFile is the file that processes lock to coordinate access to the
+// cache. Writes to single files are atomic, so they only need a shared lock.
+// Operations that span several files, like swapping installations or
+// pruning, take an exclusive lock, so no reader sees them half done.
+const cacheLockFile = ".lock"
+
+// lock takes an advisory lock on the cache, and returns a function that
+// releases it. Locks are held by open files rather than processes, so a
+// process must not take a second lock while it holds one.
+func (c *Cache) lock(exclusive bool) (unlock func(), err error) {
+	unlock, _, err = c.tryLock(exclusive, exclusive)
+	return unlock, err
+}
+
+// lockWrite takes a shared lock on the cache for writing single files. Unlike
+// readers, writers never go ahead without a lock, so the cache is created if
+// it doesn't exist yet.
+func (c *Cache) lockWrite() (unlock func(), err error) {
+	unlock, _, err = c.tryLock(false, true)
+	return unlock, err
+}
+
+// tryLock is like [Cache.lock], but also reports whether a lock was taken.
+// Readers go ahead without one when the cache can't be written to.
+func (c *Cache) tryLock(exclusive bool, write bool) (unlock func(), locked bool, err error) {
+	p := filepath.Join(c.dir, cacheLockFile)
+
+	if exclusive || write {
+		if err := os.MkdirAll(c.dir, 0o755); err != nil {
+			return nil, false, err
+		}
+	}
+
+	f, err := os.OpenFile(p, os.O_RDONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		// There is nothing to read from a cache that doesn't exist, and
+		// nothing can be written to one that can't be written to, so
+		// readers can go ahead without a lock.
+		if !exclusive && !write && (errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) || isReadOnlyFS(err)) {
+			slog.Debug("reading cache without a lock", "dir", c.dir, "err", err)
+			return func() {}, false, nil
+		}
+
+		return nil, false, fmt.Errorf("could not open cache lock: %w", err)
+	}
+
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, false, fmt.Errorf("could not lock cache: %w", err)
+	}
+
+	return func() {
+		if err := unlockFile(f); err != nil {
+			slog.Debug("failed to unlock cache", "dir", c.dir, "err", err)
+		}
+		f.Close()
+	}, true, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to name, then renames
+// it into place, so that readers see either the old or the new contents.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.Name()
+	ok := false
+	defer func() {
+		if !ok {
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+
+	ok = true
+	return nil
+}
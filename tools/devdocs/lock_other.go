@@ -0,0 +1,20 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Advisory locks are not supported on this platform. Writes are still atomic,
+// but concurrent processes may see installations and pruning half done.
+
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+func isReadOnlyFS(err error) bool {
+	return false
+}
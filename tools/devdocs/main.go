@@ -2,8 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"golang.org/x/term"
@@ -13,6 +21,19 @@ type Context struct {
 	context.Context
 	Renderer Renderer
 	Service  *Service
+	Config   *Config
+	// Stderr is where progress is drawn, or nil if it isn't a terminal.
+	Stderr io.Writer
+}
+
+// Progress reports the progress of a task with total units of work on
+// stderr, whatever the output format, as long as stderr is a terminal.
+func (c *Context) Progress(label string, total int) Progress {
+	if c.Stderr == nil {
+		return nopProgress{}
+	}
+
+	return newProgressBar(c.Stderr, label, total)
 }
 
 type DocsetsListCmd struct{}
@@ -26,6 +47,128 @@ func (c DocsetsListCmd) Run(ctx *Context) error {
 	return ctx.Renderer.RenderDocsetList(docsets)
 }
 
+type DocsetsVersionsCmd struct {
+	Name string `arg:"" help:"Name or alias of the docset"`
+}
+
+func (c DocsetsVersionsCmd) Run(ctx *Context) error {
+	docsets, err := ctx.Service.DocsetVersions(ctx, c.Name)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderDocsetList(docsets)
+}
+
+type DocsetsInstallCmd struct {
+	Docset string `arg:"" help:"Docset to install"`
+}
+
+func (c DocsetsInstallCmd) Run(ctx *Context) error {
+	change, err := ctx.Service.InstallDocset(ctx, c.Docset)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderDocsetChanges([]DocsetChange{change})
+}
+
+type DocsetsImportCmd struct {
+	Dir     string   `arg:"" help:"Directory to import docsets from, like the public/docs directory of a DevDocs checkout" type:"existingdir"`
+	Docsets []string `arg:"" optional:"" help:"Docsets to import. Defaults to all docsets in the directory"`
+}
+
+func (c DocsetsImportCmd) Run(ctx *Context) error {
+	changes, err := ctx.Service.ImportDocsets(ctx, c.Dir, c.Docsets)
+
+	// Report the docsets that were imported, even if others failed.
+	if rerr := ctx.Renderer.RenderDocsetChanges(changes); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+
+	return err
+}
+
+type DocsetsPrefetchCmd struct {
+	Docset  string   `arg:"" help:"Docset to prefetch"`
+	Types   []string `help:"Only prefetch entries of these types" sep:"," placeholder:"TYPE"`
+	Workers int      `help:"How many documents to fetch at once" default:"4"`
+	Rate    float64  `help:"Most requests per second to send to DevDocs, or 0 for no limit" default:"5"`
+}
+
+func (c DocsetsPrefetchCmd) Run(ctx *Context) error {
+	result, err := ctx.Service.PrefetchDocset(ctx, c.Docset, PrefetchOptions{
+		Types:   c.Types,
+		Workers: c.Workers,
+		Rate:    c.Rate,
+		Progress: func(total int) Progress {
+			return ctx.Progress("prefetching "+c.Docset, total)
+		},
+	})
+	if result.Documents == 0 {
+		return err
+	}
+
+	// Report what was prefetched, even if it was interrupted.
+	if rerr := ctx.Renderer.RenderPrefetchResult(result); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+
+	return err
+}
+
+type DocsetsInstalledCmd struct{}
+
+func (c DocsetsInstalledCmd) Run(ctx *Context) error {
+	docsets, err := ctx.Service.ListInstalledDocsets(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderDocsetList(docsets)
+}
+
+type DocsetsUpdateCmd struct {
+	Docsets []string `arg:"" optional:"" help:"Docsets to update. Defaults to all installed docsets"`
+}
+
+func (c DocsetsUpdateCmd) Run(ctx *Context) error {
+	changes, err := ctx.Service.UpdateDocsets(ctx, c.Docsets)
+
+	// Report the docsets that did update, even if others failed.
+	if rerr := ctx.Renderer.RenderDocsetChanges(changes); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+
+	return err
+}
+
+type DocsetsUninstallCmd struct {
+	Docset string `arg:"" help:"Docset to uninstall"`
+}
+
+func (c DocsetsUninstallCmd) Run(ctx *Context) error {
+	change, err := ctx.Service.UninstallDocset(ctx, c.Docset)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderDocsetChanges([]DocsetChange{change})
+}
+
+type DocsetsRollbackCmd struct {
+	Docset string `arg:"" help:"Docset to roll back"`
+}
+
+func (c DocsetsRollbackCmd) Run(ctx *Context) error {
+	change, err := ctx.Service.RollbackDocset(ctx, c.Docset)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderDocsetChanges([]DocsetChange{change})
+}
+
 type EntriesListCmd struct {
 	Docset string `arg:"" help:"Docset to retrieve"`
 }
@@ -40,48 +183,292 @@ func (c EntriesListCmd) Run(ctx *Context) error {
 }
 
 type EntriesShowCmd struct {
-	Docset string `arg:"" help:"Docset to retrieve documentation from"`
-	Path   string `arg:"" help:"Path to the entry"`
+	Docset      string   `arg:"" help:"Docset to retrieve documentation from"`
+	Path        string   `arg:"" help:"Path to the entry"`
+	Section     []string `help:"Show a section, by id or by its heading. Repeat to show several, in document order" short:"s" sep:"none" placeholder:"TEXT-OR-ID"`
+	Shallow     bool     `help:"Leave out the subsections of each section"`
+	Breadcrumbs bool     `help:"Print the title of the document and the headings above each section"`
 }
 
 func (c EntriesShowCmd) Run(ctx *Context) error {
-	view, err := ctx.Service.ShowEntry(ctx, c.Docset, c.Path)
+	view, err := ctx.Service.ShowEntry(ctx, c.Docset, c.Path, ShowOptions{
+		Sections: c.Section,
+		Shallow:  c.Shallow,
+	})
 	if err != nil {
 		return err
 	}
 
+	// Renderers that have somewhere else to put breadcrumbs ignore this.
+	view.Header = c.Breadcrumbs
+
 	return ctx.Renderer.RenderEntryView(view)
 }
 
+type EntriesOutlineCmd struct {
+	Docset string `arg:"" help:"Docset to retrieve documentation from"`
+	Path   string `arg:"" help:"Path to the document, or to any entry in it"`
+}
+
+func (c EntriesOutlineCmd) Run(ctx *Context) error {
+	outline, err := ctx.Service.OutlineDocument(ctx, c.Docset, c.Path)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderDocumentOutline(outline)
+}
+
+type SearchCmd struct {
+	Args      []string `arg:"" name:"query" help:"Docset to search, followed by the search terms. Leave out the docset when using --docsets or --installed"`
+	Docsets   []string `help:"Search several docsets at once" sep:"," placeholder:"SLUG" xor:"scope"`
+	Installed bool     `help:"Search every installed docset" xor:"scope"`
+	Limit     int      `help:"Maximum number of results, or 0 for all" default:"20"`
+}
+
+func (c SearchCmd) Run(ctx *Context) error {
+	docsets := c.Docsets
+	terms := c.Args
+
+	switch {
+	case c.Installed:
+		installed, err := ctx.Service.ListInstalledDocsets(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range installed {
+			docsets = append(docsets, d.Slug)
+		}
+
+		if len(docsets) == 0 {
+			return errors.New("no docsets are installed")
+		}
+	case len(docsets) == 0:
+		if len(terms) < 2 {
+			return errors.New("expected a docset followed by search terms")
+		}
+
+		docsets = terms[:1]
+		terms = terms[1:]
+	}
+
+	results, err := ctx.Service.Search(ctx, docsets, strings.Join(terms, " "), c.Limit)
+
+	// Show what was found, even if some docsets could not be searched.
+	if rerr := ctx.Renderer.RenderSearchResults(results); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+
+	return err
+}
+
+type ConfigGetCmd struct {
+	Key string `arg:"" help:"Name of the flag to get the configured value of"`
+}
+
+func (c ConfigGetCmd) Run(ctx *Context, k *kong.Kong) error {
+	f, ok := configFlags(k.Model)[c.Key]
+	if !ok {
+		return fmt.Errorf("unknown config key %q", c.Key)
+	}
+
+	value := ConfigValue{Key: c.Key}
+	if v, ok := ctx.Config.Get(c.Key); ok {
+		value.Value = v
+	} else {
+		value.Value = f.Default
+		value.IsDefault = true
+	}
+
+	return ctx.Renderer.RenderConfigValue(value)
+}
+
+type ConfigSetCmd struct {
+	Key   string `arg:"" help:"Name of the flag to configure"`
+	Value string `arg:"" help:"Default value for the flag"`
+}
+
+func (c ConfigSetCmd) Run(ctx *Context, k *kong.Kong) error {
+	f, ok := configFlags(k.Model)[c.Key]
+	if !ok {
+		return fmt.Errorf("unknown config key %q", c.Key)
+	}
+
+	if err := validateConfigValue(f, c.Value); err != nil {
+		return err
+	}
+
+	ctx.Config.Set(c.Key, c.Value)
+	if err := ctx.Config.Save(); err != nil {
+		return fmt.Errorf("could not save config file %q: %w", ctx.Config.Path(), err)
+	}
+
+	return ctx.Renderer.RenderConfigValue(ConfigValue{Key: c.Key, Value: c.Value})
+}
+
+type ConfigListCmd struct{}
+
+func (c ConfigListCmd) Run(ctx *Context) error {
+	values := make([]ConfigValue, 0)
+	for _, k := range ctx.Config.Keys() {
+		v, _ := ctx.Config.Get(k)
+		values = append(values, ConfigValue{Key: k, Value: v})
+	}
+
+	return ctx.Renderer.RenderConfigList(values)
+}
+
+type CacheStatsCmd struct{}
+
+func (c CacheStatsCmd) Run(ctx *Context) error {
+	stats, err := ctx.Service.CacheStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderCacheStats(stats)
+}
+
+type CachePruneCmd struct {
+	MaxSize ByteSize `help:"Remove least recently used resources until the cache is this size. Installed docsets don't count" default:"1GiB" env:"DEVDOCS_CACHE_MAX_SIZE"`
+}
+
+func (c CachePruneCmd) Run(ctx *Context) error {
+	cleanup, err := ctx.Service.PruneCache(ctx, int64(c.MaxSize))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderCacheCleanup(cleanup)
+}
+
+type CacheClearCmd struct {
+	All bool `help:"Remove installed docsets too"`
+}
+
+func (c CacheClearCmd) Run(ctx *Context) error {
+	cleanup, err := ctx.Service.ClearCache(ctx, c.All)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Renderer.RenderCacheCleanup(cleanup)
+}
+
+type CacheVerifyCmd struct {
+	DryRun bool `help:"Report corrupt files without repairing them"`
+}
+
+func (c CacheVerifyCmd) Run(ctx *Context) error {
+	problems, err := ctx.Service.VerifyCache(ctx, c.DryRun)
+
+	// Report what was repaired, even if other repairs failed.
+	if rerr := ctx.Renderer.RenderCacheProblems(problems); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+
+	return err
+}
+
+type MirrorServeCmd struct {
+	Addr string `help:"Address to listen on" default:":9292" env:"DEVDOCS_MIRROR_ADDR"`
+}
+
+func (c MirrorServeCmd) Run(ctx *Context) error {
+	return ctx.Service.ServeMirror(ctx, c.Addr)
+}
+
 type CLI struct {
-	Debug     bool   `help:"Enable debug mode"`
-	Format    string `help:"Specify the output format" default:"console" enum:"console,porcelain,json"`
-	JSON      bool   `help:"Print JSON. Shortcut for --format=json" xor:"fmt"`
-	Porcelain bool   `help:"Print script-friendly text. Shortcut for --format=porcelain" xor:"fmt"`
-	Docsets   struct {
-		List DocsetsListCmd `cmd:"" help:"List all docsets"`
+	Debug            bool          `help:"Enable debug mode" env:"DEVDOCS_DEBUG"`
+	Format           string        `help:"Specify the output format" default:"console" enum:"console,porcelain,json" env:"DEVDOCS_FORMAT"`
+	JSON             bool          `help:"Print JSON. Shortcut for --format=json" xor:"fmt"`
+	Porcelain        bool          `help:"Print script-friendly text. Shortcut for --format=porcelain" xor:"fmt"`
+	Remotes          []string      `help:"Remotes to fetch documentation from, in order of priority" sep:"," default:"${default_remotes}" placeholder:"NAME" env:"DEVDOCS_REMOTES"`
+	URL              string        `name:"url" help:"Base URL of the public remote" default:"${devdocs_url}" env:"DEVDOCS_URL"`
+	DocumentsURL     string        `name:"documents-url" help:"Base URL of documents on the public remote" default:"${devdocs_documents_url}" env:"DEVDOCS_DOCUMENTS_URL"`
+	Timeout          time.Duration `help:"Timeout for requests to DevDocs" default:"10s" env:"DEVDOCS_TIMEOUT"`
+	Pager            string        `help:"Command to page console output through. Defaults to $PAGER" env:"DEVDOCS_PAGER"`
+	FallbackPager    string        `help:"Command to page console output through when no other pager is set" default:"${fallback_pager}" env:"DEVDOCS_FALLBACK_PAGER"`
+	DocsDir          []string      `help:"Directories to read docsets from before the remotes, holding docs.json, <slug>/index.json and <slug>/<path>.html" type:"path" sep:"," placeholder:"DIR" env:"DEVDOCS_DOCS_DIR"`
+	CacheDir         string        `help:"Directory to cache DevDocs data in. Defaults to the user cache directory" type:"path" placeholder:"DIR" env:"DEVDOCS_CACHE_DIR"`
+	SharedCache      []string      `help:"Read-only cache directories to read from after the cache directory, e.g. one provisioned for a team" type:"path" sep:"," placeholder:"DIR" env:"DEVDOCS_SHARED_CACHE"`
+	CacheCompression Compression   `help:"How to compress cached documents" default:"zstd" enum:"zstd,gzip,none" env:"DEVDOCS_CACHE_COMPRESSION"`
+	NoCache          bool          `help:"Do not read or write the cache" env:"DEVDOCS_NO_CACHE"`
+	Offline          bool          `help:"Only use cached and installed data, without connecting to DevDocs" env:"DEVDOCS_OFFLINE"`
+	CacheTTL         CacheTTL      `embed:"" prefix:"cache-ttl-" envprefix:"DEVDOCS_CACHE_TTL_"`
+	Retry            RetryPolicy   `embed:"" prefix:"retry-" envprefix:"DEVDOCS_RETRY_"`
+
+	Docsets struct {
+		List      DocsetsListCmd      `cmd:"" help:"List all docsets"`
+		Versions  DocsetsVersionsCmd  `cmd:"" help:"List the available releases of a docset"`
+		Install   DocsetsInstallCmd   `cmd:"" help:"Download a docset for offline use"`
+		Import    DocsetsImportCmd    `cmd:"" help:"Install docsets from a local directory"`
+		Prefetch  DocsetsPrefetchCmd  `cmd:"" help:"Fetch and convert every document of a docset into the cache"`
+		Installed DocsetsInstalledCmd `cmd:"" help:"List installed docsets"`
+		Update    DocsetsUpdateCmd    `cmd:"" help:"Update installed docsets"`
+		Uninstall DocsetsUninstallCmd `cmd:"" help:"Remove an installed docset"`
+		Rollback  DocsetsRollbackCmd  `cmd:"" help:"Restore the previous installation of a docset"`
 	} `cmd:"" help:"Get information about docsets"`
 
 	Entries struct {
-		List EntriesListCmd `cmd:"" help:"List all entries in a docset"`
-		Show EntriesShowCmd `cmd:"" help:"Show documentation for an entry"`
+		List    EntriesListCmd    `cmd:"" help:"List all entries in a docset"`
+		Show    EntriesShowCmd    `cmd:"" help:"Show documentation for an entry"`
+		Outline EntriesOutlineCmd `cmd:"" help:"List the sections of a document, and the ids that link to them"`
 	} `cmd:"" help:"Get information about entries"`
+
+	Search SearchCmd `cmd:"" help:"Search for entries by name"`
+
+	Cache struct {
+		Stats  CacheStatsCmd  `cmd:"" help:"Show how much space the cache uses"`
+		Prune  CachePruneCmd  `cmd:"" help:"Remove unused and least recently used resources from the cache"`
+		Clear  CacheClearCmd  `cmd:"" help:"Remove every cached resource"`
+		Verify CacheVerifyCmd `cmd:"" help:"Find and repair corrupt files in the cache"`
+	} `cmd:"" help:"Manage the cache"`
+
+	Mirror struct {
+		Serve MirrorServeCmd `cmd:"" help:"Serve installed docsets over HTTP, in the same layout as DevDocs"`
+	} `cmd:"" help:"Share installed docsets with other tools"`
+
+	Config struct {
+		Get  ConfigGetCmd  `cmd:"" help:"Print the configured value of a flag"`
+		Set  ConfigSetCmd  `cmd:"" help:"Configure the default value of a flag"`
+		List ConfigListCmd `cmd:"" help:"List configured values"`
+	} `cmd:"" help:"Manage the configuration file"`
 }
 
 func main() {
 	var cli CLI
-	ctx := kong.Parse(
+	config, configErr := loadConfig()
+	parser := kong.Must(
 		&cli,
 		kong.UsageOnError(),
 		kong.ConfigureHelp(kong.HelpOptions{
 			Compact: true,
 		}),
+		kong.Vars{
+			"devdocs_url":           DefaultDevDocsURL,
+			"devdocs_documents_url": DefaultDevDocsDocumentsURL,
+			"fallback_pager":        DefaultFallbackPager,
+			"default_remotes":       strings.Join(config.DefaultRemotes(), ","),
+		},
+		kong.Resolvers(config.Resolver()),
 	)
+	parser.FatalIfErrorf(configErr)
+
+	ctx, err := parser.Parse(os.Args[1:])
+	parser.FatalIfErrorf(err)
 
 	if cli.Debug {
 		SetLogLevel(slog.LevelDebug)
 	}
 
+	var stderr io.Writer
+	isTTY := term.IsTerminal(int(os.Stderr.Fd()))
+	if isTTY {
+		stderr = os.Stderr
+	}
+
 	var renderer Renderer
 	// Prefer the shortcut flags --json and --porcelain.
 	if cli.JSON {
@@ -95,17 +482,118 @@ func main() {
 	case "porcelain":
 		renderer = NewPorcelainRenderer(os.Stdout)
 	default:
-		isTTY := term.IsTerminal(int(os.Stderr.Fd()))
-		renderer = NewConsoleRenderer(os.Stdout, os.Stderr, isTTY)
+		renderer = NewConsoleRenderer(os.Stdout, os.Stderr, isTTY, PagerConfig{
+			Command:  cli.Pager,
+			Fallback: cli.FallbackPager,
+		})
+	}
+
+	var cache *Cache
+	if !cli.NoCache {
+		dir := cli.CacheDir
+		if dir == "" {
+			d, err := userCacheDir()
+			ctx.FatalIfErrorf(err, "could not determine cache directory")
+			dir = d
+		}
+		cache = NewCache(dir, CacheOptions{
+			Shared:      cli.SharedCache,
+			Compression: cli.CacheCompression,
+		})
 	}
 
-	err := ctx.Run(&Context{
-		Context:  context.Background(),
+	remotes, err := newRemotes(&cli, config, cache)
+	ctx.FatalIfErrorf(err)
+
+	sources := make([]Source, 0, len(cli.DocsDir))
+	for _, dir := range cli.DocsDir {
+		sources = append(sources, NewDirSource(dir))
+	}
+
+	// Cancel on the first interrupt, so commands can stop cleanly, and exit
+	// right away on the second.
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(runCtx, stop)
+
+	err = ctx.Run(&Context{
+		Context:  runCtx,
 		Renderer: renderer,
+		Stderr:   stderr,
 		Service: NewService(
-			DefaultClient,
+			remotes,
+			cache,
 			DefaultMarkdownConverter,
+			sources...,
 		),
+		Config: config,
 	})
 	ctx.FatalIfErrorf(err)
 }
+
+// loadConfig reads the configuration file. If it can't be read, an empty
+// configuration is returned along with the error.
+func loadConfig() (*Config, error) {
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return NewConfig(""), fmt.Errorf("could not determine config file location: %w", err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return NewConfig(path), err
+	}
+
+	return config, nil
+}
+
+// newRemotes creates a client for each remote selected with --remotes. The
+// public remote is configured with --url and --documents-url, unless it has
+// its own [remote.public] table.
+func newRemotes(cli *CLI, config *Config, cache *Cache) (Remotes, error) {
+	httpClient := &http.Client{
+		Timeout: cli.Timeout,
+	}
+
+	remotes := make(Remotes, 0, len(cli.Remotes))
+	for _, name := range cli.Remotes {
+		rc, ok := config.Remote(name)
+		if !ok && name == PublicRemote {
+			rc = RemoteConfig{
+				URL:          cli.URL,
+				DocumentsURL: cli.DocumentsURL,
+			}
+		} else if !ok {
+			return nil, fmt.Errorf("unknown remote %q", name)
+		}
+
+		documentsURL, err := rc.documentsURL()
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL for remote %q: %w", name, err)
+		}
+
+		credentials, err := NewCredentials(rc.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth for remote %q: %w", name, err)
+		}
+
+		client, err := NewClient(ClientOptions{
+			Name:         name,
+			Client:       httpClient,
+			RootURL:      rc.URL,
+			DocumentsURL: documentsURL,
+			Cache:        cache,
+			TTL:          cli.CacheTTL,
+			Credentials:  credentials,
+			Retry:        cli.Retry,
+			Offline:      cli.Offline,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL for remote %q: %w", name, err)
+		}
+
+		remotes = append(remotes, client)
+	}
+
+	return remotes, nil
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"runtime/debug"
 
 	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
 	"github.com/PuerkitoBio/goquery"
@@ -10,15 +14,32 @@ import (
 
 type HTMLPreprocessor interface {
 	Preprocess(s *goquery.Selection) (*goquery.Selection, error)
+	// Name identifies the preprocessor in the converter's fingerprint, so it
+	// must be the same in every process.
+	Name() string
 }
 
 type HTMLPreprocessorFunc func(s *goquery.Selection) (*goquery.Selection, error)
 
-func (h HTMLPreprocessorFunc) Preprocess(s *goquery.Selection) (*goquery.Selection, error) {
-	return h(s)
+type namedPreprocessor struct {
+	name string
+	f    HTMLPreprocessorFunc
 }
 
-var NormalizeLanguagesOnCodeBlocks = HTMLPreprocessorFunc(func(s *goquery.Selection) (*goquery.Selection, error) {
+// NewHTMLPreprocessor creates a preprocessor named name from f.
+func NewHTMLPreprocessor(name string, f HTMLPreprocessorFunc) HTMLPreprocessor {
+	return namedPreprocessor{name: name, f: f}
+}
+
+func (p namedPreprocessor) Preprocess(s *goquery.Selection) (*goquery.Selection, error) {
+	return p.f(s)
+}
+
+func (p namedPreprocessor) Name() string {
+	return p.name
+}
+
+var NormalizeLanguagesOnCodeBlocks = NewHTMLPreprocessor("normalize-languages-on-code-blocks", func(s *goquery.Selection) (*goquery.Selection, error) {
 	s.Find("[data-language]").Each(func(i int, s *goquery.Selection) {
 		lang, _ := s.Attr("data-language")
 		switch lang {
@@ -31,7 +52,7 @@ var NormalizeLanguagesOnCodeBlocks = HTMLPreprocessorFunc(func(s *goquery.Select
 	return s, nil
 })
 
-var AddLanguageClassesToCodeBlocks = HTMLPreprocessorFunc(func(s *goquery.Selection) (*goquery.Selection, error) {
+var AddLanguageClassesToCodeBlocks = NewHTMLPreprocessor("add-language-classes-to-code-blocks", func(s *goquery.Selection) (*goquery.Selection, error) {
 	s.Find("[data-language]").Each(func(i int, s *goquery.Selection) {
 		lang, _ := s.Attr("data-language")
 		s.AddClass("language-" + lang)
@@ -40,10 +61,57 @@ var AddLanguageClassesToCodeBlocks = HTMLPreprocessorFunc(func(s *goquery.Select
 	return s, nil
 })
 
+// MarkdownConverterVersion is part of every converter's fingerprint. Bump it
+// whenever a change to the conversion or the document index would make
+// previously cached Markdown wrong.
+const MarkdownConverterVersion = 6
+
 type MarkdownConverter struct {
 	Preprocessors []HTMLPreprocessor
 }
 
+// Fingerprint identifies the output of the converter: its version, the
+// version of html-to-markdown, and its preprocessors, in order. Markdown that
+// was converted with a different fingerprint must not be reused.
+func (m *MarkdownConverter) Fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "version %d\n", MarkdownConverterVersion)
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/JohannesKaufmann/html-to-markdown/v2" {
+				fmt.Fprintf(h, "html-to-markdown %s\n", dep.Version)
+			}
+		}
+	}
+
+	for _, p := range m.Preprocessors {
+		fmt.Fprintf(h, "preprocessor %s\n", preprocessorName(p))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// CacheKey returns the key that src converted to Markdown is cached under.
+// It covers the content of the document, so updated documents are converted
+// again.
+func (m *MarkdownConverter) CacheKey(src *HTMLDocument) string {
+	h := sha256.New()
+	io.Copy(h, src.Content.Reader())
+	return m.Fingerprint() + "/" + src.Docset + "/" + hex.EncodeToString(h.Sum(nil))
+}
+
+// preprocessorName returns the name of p, or its type if it has none. Values
+// are never part of the name, since they may hold pointers that differ from
+// one process to the next.
+func preprocessorName(p HTMLPreprocessor) string {
+	if name := p.Name(); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("%T", p)
+}
+
 func (m *MarkdownConverter) Convert(src *HTMLDocument) (*MarkdownDocument, error) {
 	html, err := goquery.NewDocumentFromReader(src.Content.Reader())
 	if err != nil {
@@ -58,11 +126,17 @@ func (m *MarkdownConverter) Convert(src *HTMLDocument) (*MarkdownDocument, error
 		}
 	}
 
-	headings := sel.Find("h2, h3, h4, h5, h6")
-	ids := headings.Map(func(i int, s *goquery.Selection) string {
-		return s.AttrOr("id", "")
+	anchors := make([]HeadingAnchor, 0)
+	sel.Find("h1, h2, h3, h4, h5, h6").Each(func(i int, s *goquery.Selection) {
+		anchors = append(anchors, HeadingAnchor{
+			Level: int(goquery.NodeName(s)[1] - '0'),
+			ID:    s.AttrOr("id", ""),
+			Text:  s.Text(),
+		})
 	})
 
+	fragments := markAnchors(sel)
+
 	buf := new(bytes.Buffer)
 	for _, node := range sel.Nodes {
 		md, err := htmltomarkdown.ConvertNode(node)
@@ -73,9 +147,12 @@ func (m *MarkdownConverter) Convert(src *HTMLDocument) (*MarkdownDocument, error
 		buf.Write(md)
 	}
 
-	data := buf.Bytes()
+	data, fragments, err := removeAnchorMarks(buf.Bytes(), fragments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index anchors: %w", err)
+	}
 
-	idx, err := BuildDocumentIndex(data, ids)
+	idx, err := BuildDocumentIndex(data, anchors, fragments)
 	if err != nil {
 		return nil, err
 	}
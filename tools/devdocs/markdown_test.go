@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestMarkdownConverterFingerprint(t *testing.T) {
+	newConverter := func(p ...HTMLPreprocessor) *MarkdownConverter {
+		return NewMarkdownConverter(
+			WithPreprocessors(NormalizeLanguagesOnCodeBlocks, AddLanguageClassesToCodeBlocks),
+			WithPreprocessors(p...),
+		)
+	}
+
+	// The fingerprint is cached on disk, so it must not depend on anything
+	// that changes from one construction, or one process, to the next.
+	a, b := newConverter().Fingerprint(), newConverter().Fingerprint()
+	if a != b {
+		t.Errorf("Fingerprint() = %q and %q for the same converter", a, b)
+	}
+
+	if d := DefaultMarkdownConverter.Fingerprint(); d != a {
+		t.Errorf("Fingerprint() = %q, want %q like DefaultMarkdownConverter", a, d)
+	}
+
+	strip := NewHTMLPreprocessor("strip", func(s *goquery.Selection) (*goquery.Selection, error) {
+		s.Find("script").Remove()
+		return s, nil
+	})
+	if c := newConverter(strip).Fingerprint(); c == a {
+		t.Errorf("Fingerprint() = %q with an added preprocessor, want it to change", c)
+	}
+
+	if c := NewMarkdownConverter(WithPreprocessors(AddLanguageClassesToCodeBlocks, NormalizeLanguagesOnCodeBlocks)).Fingerprint(); c == a {
+		t.Errorf("Fingerprint() = %q with reordered preprocessors, want it to change", c)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Mirror serves installed docsets over HTTP, with the same URL layout as
+// DevDocs, so that anything that reads from DevDocs (including [Client]) can
+// read from it instead:
+//
+//	/docs/docs.json
+//	/docs/<slug>/index.json
+//	/<slug>/db.json
+//	/<slug>/<path>.html
+//
+// Documents and databases are also served under /docs/, which is where
+// remotes without a documents-url look for them.
+type Mirror struct {
+	cache *Cache
+	mux   *http.ServeMux
+}
+
+func NewMirror(cache *Cache) *Mirror {
+	m := &Mirror{
+		cache: cache,
+		mux:   http.NewServeMux(),
+	}
+
+	m.mux.HandleFunc("GET /docs/docs.json", m.serveDocsets)
+	m.mux.HandleFunc("GET /docs/{slug}/index.json", m.serveIndex)
+	m.mux.HandleFunc("GET /docs/{slug}/db.json", m.serveDatabase)
+	m.mux.HandleFunc("GET /docs/{slug}/{path...}", m.serveDocument)
+	m.mux.HandleFunc("GET /{slug}/db.json", m.serveDatabase)
+	m.mux.HandleFunc("GET /{slug}/{path...}", m.serveDocument)
+
+	return m
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("serving mirror request", "method", r.Method, "path", r.URL.Path)
+	m.mux.ServeHTTP(w, r)
+}
+
+func (m *Mirror) serveDocsets(w http.ResponseWriter, r *http.Request) {
+	installed, err := m.cache.InstalledDocsets()
+	if err != nil {
+		mirrorError(w, r, err)
+		return
+	}
+
+	list := make([]Docset, 0, len(installed))
+	for _, i := range installed {
+		list = append(list, i.Docset)
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		mirrorError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (m *Mirror) serveIndex(w http.ResponseWriter, r *http.Request) {
+	inst, ok := m.installed(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := inst.Index()
+	if err != nil {
+		mirrorError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, r, "index.json", inst.InstalledAt, bytes.NewReader(data))
+}
+
+func (m *Mirror) serveDatabase(w http.ResponseWriter, r *http.Request) {
+	inst, ok := m.installed(w, r)
+	if !ok {
+		return
+	}
+
+	db, err := inst.OpenDatabase()
+	if err != nil {
+		mirrorError(w, r, err)
+		return
+	}
+	defer db.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := io.Copy(w, db); err != nil {
+		slog.Debug("failed to send database", "slug", inst.Slug, "err", err)
+	}
+}
+
+func (m *Mirror) serveDocument(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutSuffix(r.PathValue("path"), ".html")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	inst, ok := m.installed(w, r)
+	if !ok {
+		return
+	}
+
+	doc, err := inst.GetDocument(EntryLocator{Path: path})
+	if err != nil {
+		mirrorError(w, r, err)
+		return
+	}
+
+	html, err := doc.Content.Bytes()
+	if err != nil {
+		mirrorError(w, r, err)
+		return
+	}
+
+	// Installing the docset again is the only way its documents change, so
+	// clients can revalidate with If-Modified-Since.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, path+".html", inst.InstalledAt, bytes.NewReader(html))
+}
+
+// installed finds the installed docset named in the request, responding with
+// an error if there is none.
+func (m *Mirror) installed(w http.ResponseWriter, r *http.Request) (*InstalledDocset, bool) {
+	slug := r.PathValue("slug")
+	if !isValidSlug(slug) {
+		http.NotFound(w, r)
+		return nil, false
+	}
+
+	inst, err := m.cache.InstalledDocset(slug)
+	if err != nil {
+		mirrorError(w, r, err)
+		return nil, false
+	}
+
+	return inst, true
+}
+
+func mirrorError(w http.ResponseWriter, r *http.Request, err error) {
+	if isCacheMiss(err) || errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+
+	slog.Warn("could not serve mirror request", "path", r.URL.Path, "err", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,59 @@
+package main
+
+// DocumentOutline lists the sections and fragments of a document, which are
+// what can follow the # in the path of an entry.
+type DocumentOutline struct {
+	Docset   string           `json:"docset"`
+	Path     string           `json:"path"`
+	Sections []OutlineSection `json:"sections"`
+}
+
+type OutlineSection struct {
+	DocumentSection
+	// Permalink is empty for headings without an id.
+	Permalink string `json:"permalink"`
+}
+
+func NewDocumentOutline(doc *MarkdownDocument) *DocumentOutline {
+	o := &DocumentOutline{
+		Docset:   doc.Docset,
+		Path:     doc.Entry.Path,
+		Sections: make([]OutlineSection, 0, len(doc.Index.Sections)),
+	}
+
+	for _, s := range doc.Index.Sections {
+		var link string
+		if s.ID != "" {
+			link = Permalink(doc.Docset, EntryLocator{Path: doc.Entry.Path, Fragment: s.ID})
+		}
+
+		o.Sections = append(o.Sections, OutlineSection{
+			DocumentSection: s,
+			Permalink:       link,
+		})
+	}
+
+	return o
+}
+
+// Depths returns how deeply each section is nested under the headings before
+// it. Fragments are nested one level under the heading they are in.
+func (o *DocumentOutline) Depths() []int {
+	depths := make([]int, len(o.Sections))
+	stack := newStack[int]()
+	for i, s := range o.Sections {
+		if s.IsFragment() {
+			depths[i] = stack.Len()
+			continue
+		}
+
+		for stack.Len() > 0 && stack.Top() >= s.Level {
+			stack.Pop()
+		}
+
+		depths[i] = stack.Len()
+		stack.Push(s.Level)
+	}
+
+	return depths
+}
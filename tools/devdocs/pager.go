@@ -13,10 +13,19 @@ import (
 )
 
 var (
-	ErrNoDevDocsPager = errors.New("no DEVDOCS_PAGER environment variable set")
+	ErrNoDevDocsPager = errors.New("no pager configured with --pager or DEVDOCS_PAGER")
 	ErrNoEnvPager     = errors.New("no PAGER environment variable set")
 )
 
+const DefaultFallbackPager = "less -R -F"
+
+// PagerConfig selects the pager command. Command is preferred, then $PAGER,
+// then Fallback.
+type PagerConfig struct {
+	Command  string
+	Fallback string
+}
+
 type PagerVars struct {
 	Filename string
 	Language string
@@ -108,23 +117,23 @@ func (p *Pager) Wrap(stdout io.WriteCloser, stderr io.WriteCloser) (*PagerWriter
 	}, nil
 }
 
-func LookupPager(vars PagerVars) (*Pager, error) {
-	p, err := lookupDevDocsPager(vars)
+func LookupPager(vars PagerVars, cfg PagerConfig) (*Pager, error) {
+	p, err := lookupDevDocsPager(vars, cfg)
 
 	if errors.Is(err, ErrNoDevDocsPager) {
 		p, err = lookupEnvPager(vars)
 	}
 
 	if errors.Is(err, ErrNoEnvPager) {
-		p, err = lookupDefaultPager(vars)
+		p, err = lookupDefaultPager(vars, cfg)
 	}
 
 	return p, err
 }
 
-func lookupDevDocsPager(vars PagerVars) (*Pager, error) {
-	cmd, isSet := os.LookupEnv("DEVDOCS_PAGER")
-	if !isSet || cmd == "" {
+func lookupDevDocsPager(vars PagerVars, cfg PagerConfig) (*Pager, error) {
+	cmd := cfg.Command
+	if cmd == "" {
 		return nil, ErrNoDevDocsPager
 	}
 
@@ -144,8 +153,13 @@ func lookupEnvPager(vars PagerVars) (*Pager, error) {
 	})
 }
 
-func lookupDefaultPager(vars PagerVars) (*Pager, error) {
-	return NewPager("less -R -F", vars, PagerOpts{
+func lookupDefaultPager(vars PagerVars, cfg PagerConfig) (*Pager, error) {
+	cmd := cfg.Fallback
+	if cmd == "" {
+		cmd = DefaultFallbackPager
+	}
+
+	return NewPager(cmd, vars, PagerOpts{
 		Normalize: false,
 	})
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// PrefetchOptions configures [Service.PrefetchDocset].
+type PrefetchOptions struct {
+	// Types limits the prefetch to entries of these types. All entries are
+	// prefetched if it is empty.
+	Types []string
+	// Workers is how many documents are fetched and converted at once.
+	Workers int
+	// Rate is the most requests per second to send to DevDocs, or 0 for no
+	// limit. Cached and installed documents don't count.
+	Rate float64
+	// Progress creates the progress of the prefetch once the number of
+	// documents is known, if set.
+	Progress func(total int) Progress
+}
+
+// PrefetchResult summarizes a prefetch. Documents that failed are logged and
+// counted, but don't stop the others.
+type PrefetchResult struct {
+	Docset    string `json:"docset"`
+	Documents int    `json:"documents"`
+	Converted int    `json:"converted"`
+	Failed    int    `json:"failed"`
+}
+
+// PrefetchDocset fetches and converts every document of a docset, so that
+// they are in the cache for later. Documents that are already cached are not
+// fetched again, so an interrupted prefetch picks up where it left off when
+// run again.
+func (s *Service) PrefetchDocset(ctx context.Context, name string, opts PrefetchOptions) (PrefetchResult, error) {
+	result := PrefetchResult{Docset: name}
+
+	if s.cache == nil {
+		return result, fmt.Errorf("could not prefetch docset %q: %w", name, ErrNoCache)
+	}
+
+	_, m, err := s.entryIndex(ctx, name)
+	if err != nil {
+		return result, fmt.Errorf("could not prefetch docset %q: %w", name, err)
+	}
+	result.Docset = m.Docset
+
+	paths := prefetchPaths(m.Entries, opts.Types)
+	if len(paths) == 0 {
+		return result, fmt.Errorf("could not prefetch docset %q: no entries of type %q", m.Docset, opts.Types)
+	}
+	result.Documents = len(paths)
+
+	source := s.source
+	if opts.Rate > 0 {
+		source = source.RateLimited(newRateLimiter(opts.Rate))
+	}
+
+	var progress Progress = nopProgress{}
+	if opts.Progress != nil {
+		progress = opts.Progress(len(paths))
+	}
+
+	// Each worker takes paths until there are none left, or the context is
+	// canceled.
+	next := make(chan string)
+	go func() {
+		defer close(next)
+		for _, p := range paths {
+			select {
+			case next <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Failures are logged once the progress is done, so that the warnings
+	// don't break up the progress bar.
+	type failure struct {
+		path string
+		err  error
+	}
+	var failures []failure
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for range max(opts.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for p := range next {
+				err := s.prefetch(ctx, source, m.Docset, p)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					result.Converted++
+				case ctx.Err() == nil:
+					failures = append(failures, failure{path: p, err: err})
+					result.Failed++
+				}
+				mu.Unlock()
+
+				progress.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	progress.Done()
+
+	for _, f := range failures {
+		slog.Warn("could not prefetch document", "docset", m.Docset, "path", f.path, "err", f.err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("prefetch of docset %q was interrupted: %w", m.Docset, err)
+	}
+
+	if result.Failed > 0 {
+		return result, fmt.Errorf("could not prefetch %d of %d documents in docset %q", result.Failed, result.Documents, m.Docset)
+	}
+
+	return result, nil
+}
+
+func (s *Service) prefetch(ctx context.Context, source Source, docset string, path string) error {
+	html, err := source.GetDocument(ctx, docset, NewEntryLocator(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.convert(html)
+	return err
+}
+
+// prefetchPaths lists the documents that the entries of the given types are
+// in, without duplicates.
+func prefetchPaths(entries []Entry, types []string) []string {
+	paths := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if len(types) > 0 && !slices.Contains(types, e.Type) {
+			continue
+		}
+
+		p := NewEntryLocator(e.Path).Path
+		if !seen[p] {
+			paths = append(paths, p)
+			seen[p] = true
+		}
+	}
+
+	return paths
+}
+
+// rateLimiter spaces requests out evenly, no matter how many goroutines send
+// them.
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+	}
+}
+
+// Wait blocks until the next request may be sent.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
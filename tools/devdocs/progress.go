@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress reports how much of a long-running task is done. It is safe to
+// use from several goroutines.
+type Progress interface {
+	// Add marks n more units of work as done.
+	Add(n int)
+	// Done clears the progress, once the task is over.
+	Done()
+}
+
+type nopProgress struct{}
+
+func (nopProgress) Add(n int) {}
+func (nopProgress) Done()     {}
+
+const (
+	progressBarWidth = 30
+	// progressRedrawInterval keeps fast tasks from flooding the terminal.
+	progressRedrawInterval = 100 * time.Millisecond
+)
+
+// progressBar draws a bar on a terminal, redrawing it in place.
+type progressBar struct {
+	w     io.Writer
+	label string
+	total int
+
+	mu     sync.Mutex
+	done   int
+	drawn  time.Time
+	closed bool
+}
+
+func newProgressBar(w io.Writer, label string, total int) *progressBar {
+	b := &progressBar{w: w, label: label, total: total}
+	b.draw()
+	return b
+}
+
+func (b *progressBar) Add(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.done += n
+	if b.done >= b.total || time.Since(b.drawn) >= progressRedrawInterval {
+		b.draw()
+	}
+}
+
+func (b *progressBar) Done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		// Erase the bar, so the output that follows starts on a clean line.
+		fmt.Fprint(b.w, "\r\x1b[K")
+		b.closed = true
+	}
+}
+
+func (b *progressBar) draw() {
+	if b.closed {
+		return
+	}
+
+	filled := progressBarWidth
+	if b.total > 0 {
+		filled = min(b.done*progressBarWidth/b.total, progressBarWidth)
+	}
+
+	fmt.Fprintf(b.w, "\r\x1b[K%s [%s%s] %d/%d",
+		b.label,
+		strings.Repeat("=", filled),
+		strings.Repeat(" ", progressBarWidth-filled),
+		b.done, b.total,
+	)
+	b.drawn = time.Now()
+}
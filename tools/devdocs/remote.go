@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PublicRemote is the name of the remote for devdocs.io.
+const PublicRemote = "public"
+
+// RemoteConfig describes a DevDocs instance to fetch documentation from, as
+// configured in a [remote.<name>] table of the configuration file:
+//
+//	[remote.corp-mirror]
+//	url = "https://devdocs.corp.example.com/"
+//	priority = 1
+//
+// See [AuthConfig] for remotes that require authentication.
+type RemoteConfig struct {
+	URL string `toml:"url"`
+	// DocumentsURL defaults to the docs/ directory under URL, which is where
+	// self-hosted DevDocs instances serve documents from.
+	DocumentsURL string `toml:"documents-url,omitempty"`
+	// Priority orders the remotes when the --remotes flag is not set. Lower
+	// priorities are tried first.
+	Priority int `toml:"priority,omitempty"`
+	// Auth configures credentials for remotes that require them.
+	Auth AuthConfig `toml:"auth,omitempty"`
+}
+
+func (r RemoteConfig) documentsURL() (string, error) {
+	if r.DocumentsURL != "" {
+		return r.DocumentsURL, nil
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return "", err
+	}
+
+	return u.JoinPath("docs").String(), nil
+}
+
+// Remotes is a list of DevDocs clients in order of priority. Requests go to
+// each remote in turn, falling back to the next one when a resource is not
+// found, the remote can't be reached or is unavailable, or there are no
+// credentials for it. In offline mode, each remote's cache is tried in turn.
+type Remotes []*Client
+
+func (r Remotes) ListDocsets(ctx context.Context) ([]Docset, error) {
+	// Mirrors may host only some docsets, so merge the lists of every
+	// remote. Earlier remotes take precedence for docsets they share.
+	list := make([]Docset, 0)
+	seen := make(map[string]bool)
+
+	var errs []error
+	var ok bool
+	for _, c := range r {
+		docsets, err := c.ListDocsets(ctx)
+		if err != nil {
+			if !shouldFallBack(err) {
+				return list, err
+			}
+
+			slog.Debug("failed to list docsets from remote", "remote", c.Name(), "err", err)
+			errs = append(errs, remoteError(c, err))
+			continue
+		}
+
+		ok = true
+		for _, d := range docsets {
+			if !seen[d.Slug] {
+				list = append(list, d)
+				seen[d.Slug] = true
+			}
+		}
+	}
+
+	if !ok {
+		return list, r.join(errs)
+	}
+
+	return list, nil
+}
+
+func (r Remotes) ListEntries(ctx context.Context, docset string) (EntryManifest, error) {
+	return firstRemote(r, func(c *Client) (EntryManifest, error) {
+		return c.ListEntries(ctx, docset)
+	})
+}
+
+func (r Remotes) GetDocument(ctx context.Context, docset string, entry EntryLocator) (*HTMLDocument, error) {
+	return firstRemote(r, func(c *Client) (*HTMLDocument, error) {
+		return c.GetDocument(ctx, docset, entry)
+	})
+}
+
+func (r Remotes) DownloadIndex(ctx context.Context, docset string) ([]byte, error) {
+	return firstRemote(r, func(c *Client) ([]byte, error) {
+		return c.DownloadIndex(ctx, docset)
+	})
+}
+
+func (r Remotes) DownloadDatabase(ctx context.Context, docset string) ([]byte, error) {
+	return firstRemote(r, func(c *Client) ([]byte, error) {
+		return c.DownloadDatabase(ctx, docset)
+	})
+}
+
+// Revalidating returns copies of the clients that revalidate every cached
+// resource before use.
+func (r Remotes) Revalidating() Remotes {
+	cp := make(Remotes, len(r))
+	for i, c := range r {
+		cp[i] = c.Revalidating()
+	}
+
+	return cp
+}
+
+// RateLimited returns copies of the clients that share the rate limiter l.
+func (r Remotes) RateLimited(l *rateLimiter) Remotes {
+	cp := make(Remotes, len(r))
+	for i, c := range r {
+		cp[i] = c.RateLimited(l)
+	}
+
+	return cp
+}
+
+func firstRemote[T any](r Remotes, f func(c *Client) (T, error)) (T, error) {
+	var errs []error
+	for _, c := range r {
+		v, err := f(c)
+		if err == nil {
+			return v, nil
+		}
+
+		if !shouldFallBack(err) {
+			return v, err
+		}
+
+		slog.Debug("falling back to next remote", "remote", c.Name(), "err", err)
+		errs = append(errs, remoteError(c, err))
+	}
+
+	var zero T
+	if len(errs) == 0 {
+		return zero, errors.New("no remotes configured")
+	}
+
+	return zero, r.join(errs)
+}
+
+func remoteError(c *Client, err error) error {
+	return fmt.Errorf("remote %q: %w", c.Name(), err)
+}
+
+func (r Remotes) join(errs []error) error {
+	// With a single remote, its name is just noise.
+	if len(r) == 1 && len(errs) == 1 {
+		return errors.Unwrap(errs[0])
+	}
+
+	return errors.Join(errs...)
+}
+
+// shouldFallBack reports whether a request that failed with err should be
+// retried with the next remote.
+func shouldFallBack(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var urlErr *url.Error
+	return errors.Is(err, ErrNotFound) ||
+		errors.Is(err, ErrNoCredentials) ||
+		errors.Is(err, ErrOffline) ||
+		errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, ErrRateLimited) ||
+		errors.As(err, &urlErr)
+}
+
+// sortRemoteNames orders the named remotes by priority, then by name.
+func sortRemoteNames(remotes map[string]RemoteConfig) []string {
+	names := make([]string, 0, len(remotes))
+	for name := range remotes {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		a, b := remotes[names[i]], remotes[names[j]]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+
+		return strings.Compare(names[i], names[j]) < 0
+	})
+
+	return names
+}
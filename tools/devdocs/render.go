@@ -5,25 +5,38 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 type Renderer interface {
 	RenderDocsetList(docsets []Docset) error
 	RenderEntryList(entries []*Entry) error
 	RenderEntryView(view *EntryView) error
+	RenderDocumentOutline(outline *DocumentOutline) error
+	RenderDocsetChanges(changes []DocsetChange) error
+	RenderSearchResults(results []SearchResult) error
+	RenderConfigValue(value ConfigValue) error
+	RenderConfigList(values []ConfigValue) error
+	RenderCacheStats(stats *CacheStats) error
+	RenderCacheCleanup(cleanup CacheCleanup) error
+	RenderCacheProblems(problems []CacheProblem) error
+	RenderPrefetchResult(result PrefetchResult) error
 }
 
 type ConsoleRenderer struct {
 	stdout io.WriteCloser
 	stderr io.WriteCloser
 	isTTY  bool
+	pager  PagerConfig
 }
 
-func NewConsoleRenderer(stdout io.WriteCloser, stderr io.WriteCloser, isTTY bool) *ConsoleRenderer {
+func NewConsoleRenderer(stdout io.WriteCloser, stderr io.WriteCloser, isTTY bool, pager PagerConfig) *ConsoleRenderer {
 	return &ConsoleRenderer{
 		stdout: stdout,
 		stderr: stderr,
 		isTTY:  isTTY,
+		pager:  pager,
 	}
 }
 
@@ -61,6 +74,23 @@ func (r *ConsoleRenderer) RenderEntryList(entries []*Entry) error {
 	return nil
 }
 
+func (r *ConsoleRenderer) RenderSearchResults(results []SearchResult) error {
+	w, err := r.text()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for _, res := range results {
+		_, err := fmt.Fprintf(w, "%s (%s %s)\n", res.Name, res.Docset, res.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *ConsoleRenderer) RenderEntryView(view *EntryView) error {
 	filename := view.Document.Entry.String()
 
@@ -79,6 +109,155 @@ func (r *ConsoleRenderer) RenderEntryView(view *EntryView) error {
 	return err
 }
 
+func (r *ConsoleRenderer) RenderDocumentOutline(outline *DocumentOutline) error {
+	w, err := r.text()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	depths := outline.Depths()
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, s := range outline.Sections {
+		// Headings look like they do in the Markdown, and fragments are
+		// listed under them.
+		marker := "-"
+		if !s.IsFragment() {
+			marker = strings.Repeat("#", s.Level)
+		}
+
+		id := s.ID
+		if id == "" {
+			id = "-"
+		}
+
+		_, err := fmt.Fprintf(tw, "%s%s %s\t%s\t%d-%d\t%s\n",
+			strings.Repeat("  ", depths[i]), marker, s.Title,
+			id, s.Lines.Start, s.Lines.End, s.Permalink,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (r *ConsoleRenderer) RenderDocsetChanges(changes []DocsetChange) error {
+	for _, c := range changes {
+		_, err := fmt.Fprintf(r.stdout, "%s %s (%s)\n", c.Action, c.Slug, describeDocsetChange(c))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func describeDocsetChange(c DocsetChange) string {
+	switch {
+	case c.Previous == nil && c.Current == nil:
+		return "unknown"
+	case c.Previous == nil:
+		return c.Current.FullName()
+	case c.Current == nil:
+		return c.Previous.FullName()
+	case *c.Previous == *c.Current:
+		return c.Current.FullName()
+	case c.Previous.FullName() == c.Current.FullName():
+		// Same release, different build.
+		return fmt.Sprintf("%s, built %s -> %s",
+			c.Current.FullName(),
+			time.Unix(c.Previous.Mtime, 0).Format(time.DateOnly),
+			time.Unix(c.Current.Mtime, 0).Format(time.DateOnly),
+		)
+	default:
+		return c.Previous.FullName() + " -> " + c.Current.FullName()
+	}
+}
+
+func (r *ConsoleRenderer) RenderConfigValue(value ConfigValue) error {
+	_, err := fmt.Fprintln(r.stdout, value.Value)
+	return err
+}
+
+func (r *ConsoleRenderer) RenderConfigList(values []ConfigValue) error {
+	for _, v := range values {
+		_, err := fmt.Fprintf(r.stdout, "%s = %s\n", v.Key, v.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *ConsoleRenderer) RenderCacheStats(stats *CacheStats) error {
+	w, err := r.text()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, u := range stats.Usage {
+		docset := u.Docset
+		if docset == "" {
+			docset = "-"
+		}
+
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%d files\t%s\t%.1fx\n", u.Kind, docset, u.Files, ByteSize(u.Size), u.Ratio)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s total (%s uncompressed, %.1fx) in %s\n", ByteSize(stats.Size), ByteSize(stats.Uncompressed), stats.Ratio, stats.Dir)
+	return err
+}
+
+func (r *ConsoleRenderer) RenderCacheCleanup(cleanup CacheCleanup) error {
+	_, err := fmt.Fprintf(r.stdout, "removed %d files (%s)\n", cleanup.Files, ByteSize(cleanup.Size))
+	return err
+}
+
+func (r *ConsoleRenderer) RenderCacheProblems(problems []CacheProblem) error {
+	for _, p := range problems {
+		action := string(p.Repair)
+		if p.Repair == CacheNotRepaired {
+			action = "corrupt"
+		}
+
+		_, err := fmt.Fprintf(r.stdout, "%s %s (%s)\n", action, p.Path, p.Error)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *ConsoleRenderer) RenderPrefetchResult(result PrefetchResult) error {
+	_, err := fmt.Fprintf(r.stdout, "prefetched %d of %d documents in %s", result.Converted, result.Documents, result.Docset)
+	if err != nil {
+		return err
+	}
+
+	if result.Failed > 0 {
+		_, err = fmt.Fprintf(r.stdout, " (%d failed)", result.Failed)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(r.stdout)
+	return err
+}
+
 func (r *ConsoleRenderer) text() (io.WriteCloser, error) {
 	return r.out(PagerVars{})
 }
@@ -88,7 +267,7 @@ func (r *ConsoleRenderer) out(vars PagerVars) (io.WriteCloser, error) {
 		return r.stdout, nil
 	}
 
-	p, err := LookupPager(vars)
+	p, err := LookupPager(vars, r.pager)
 	if err != nil {
 		return nil, err
 	}
@@ -131,11 +310,104 @@ func (r *PorcelainRenderer) RenderEntryList(entries []*Entry) error {
 	return nil
 }
 
+func (r *PorcelainRenderer) RenderSearchResults(results []SearchResult) error {
+	for _, res := range results {
+		_, err := fmt.Fprintf(r.w, "%s\t%s\t%s\t%s\t%d\n", res.Docset, res.Path, res.Type, res.Name, res.Score)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (r *PorcelainRenderer) RenderEntryView(entry *EntryView) error {
 	_, err := entry.WriteTo(r.w)
 	return err
 }
 
+func (r *PorcelainRenderer) RenderDocumentOutline(outline *DocumentOutline) error {
+	for _, s := range outline.Sections {
+		_, err := fmt.Fprintf(r.w, "%d\t%s\t%d\t%d\t%s\t%s\n", s.Level, s.ID, s.Lines.Start, s.Lines.End, s.Permalink, s.Title)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PorcelainRenderer) RenderDocsetChanges(changes []DocsetChange) error {
+	for _, c := range changes {
+		var prev, cur Docset
+		if c.Previous != nil {
+			prev = *c.Previous
+		}
+		if c.Current != nil {
+			cur = *c.Current
+		}
+
+		_, err := fmt.Fprintf(r.w, "%s\t%s\t%s\t%d\t%s\t%d\n",
+			c.Action, c.Slug,
+			prev.Release, prev.Mtime,
+			cur.Release, cur.Mtime,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PorcelainRenderer) RenderConfigValue(value ConfigValue) error {
+	_, err := fmt.Fprintln(r.w, value.Value)
+	return err
+}
+
+func (r *PorcelainRenderer) RenderConfigList(values []ConfigValue) error {
+	for _, v := range values {
+		_, err := fmt.Fprintf(r.w, "%s\t%s\n", v.Key, v.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PorcelainRenderer) RenderCacheStats(stats *CacheStats) error {
+	for _, u := range stats.Usage {
+		_, err := fmt.Fprintf(r.w, "%s\t%s\t%d\t%d\t%d\t%.2f\n", u.Kind, u.Docset, u.Files, u.Size, u.Uncompressed, u.Ratio)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PorcelainRenderer) RenderCacheCleanup(cleanup CacheCleanup) error {
+	_, err := fmt.Fprintf(r.w, "%d\t%d\n", cleanup.Files, cleanup.Size)
+	return err
+}
+
+func (r *PorcelainRenderer) RenderCacheProblems(problems []CacheProblem) error {
+	for _, p := range problems {
+		_, err := fmt.Fprintf(r.w, "%s\t%s\t%s\t%s\t%s\n", p.Repair, p.Kind, p.Docset, p.Path, p.Error)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *PorcelainRenderer) RenderPrefetchResult(result PrefetchResult) error {
+	_, err := fmt.Fprintf(r.w, "%s\t%d\t%d\t%d\n", result.Docset, result.Documents, result.Converted, result.Failed)
+	return err
+}
+
 type JSONRenderer struct {
 	e *json.Encoder
 }
@@ -157,22 +429,81 @@ func (r *JSONRenderer) RenderEntryList(entries []*Entry) error {
 	return r.e.Encode(entries)
 }
 
+func (r *JSONRenderer) RenderSearchResults(results []SearchResult) error {
+	return r.e.Encode(results)
+}
+
 func (r *JSONRenderer) RenderEntryView(view *EntryView) error {
+	// The breadcrumbs have a field of their own, so they're left out of the
+	// content.
+	content := *view
+	content.Header = false
+
 	s := new(strings.Builder)
-	_, err := view.WriteTo(s)
+	_, err := content.WriteTo(s)
 	if err != nil {
 		return err
 	}
 
+	// Documents have no ranges, but consumers shouldn't have to check for
+	// null.
+	ranges := view.Ranges
+	if ranges == nil {
+		ranges = make([]LineRange, 0)
+	}
+
+	crumbs := view.Breadcrumbs
+	if crumbs == nil {
+		crumbs = make([]string, 0)
+	}
+
 	return r.e.Encode(struct {
-		Docset  string       `json:"docset"`
-		Entry   EntryLocator `json:"entry"`
-		Lines   *LineRange   `json:"lines"`
-		Content string       `json:"content"`
+		Docset      string           `json:"docset"`
+		Entry       EntryLocator     `json:"entry"`
+		Sections    []ExcerptSection `json:"sections,omitempty"`
+		Breadcrumbs []string         `json:"breadcrumbs"`
+		Lines       *LineRange       `json:"lines"`
+		Ranges      []LineRange      `json:"ranges"`
+		Content     string           `json:"content"`
 	}{
-		Docset:  view.Document.Docset,
-		Entry:   view.Document.Entry,
-		Lines:   view.Lines,
-		Content: s.String(),
+		Docset:      view.Document.Docset,
+		Entry:       view.Document.Entry,
+		Sections:    view.Sections,
+		Breadcrumbs: crumbs,
+		Lines:       view.Lines(),
+		Ranges:      ranges,
+		Content:     s.String(),
 	})
 }
+
+func (r *JSONRenderer) RenderDocumentOutline(outline *DocumentOutline) error {
+	return r.e.Encode(outline)
+}
+
+func (r *JSONRenderer) RenderDocsetChanges(changes []DocsetChange) error {
+	return r.e.Encode(changes)
+}
+
+func (r *JSONRenderer) RenderConfigValue(value ConfigValue) error {
+	return r.e.Encode(value)
+}
+
+func (r *JSONRenderer) RenderConfigList(values []ConfigValue) error {
+	return r.e.Encode(values)
+}
+
+func (r *JSONRenderer) RenderCacheStats(stats *CacheStats) error {
+	return r.e.Encode(stats)
+}
+
+func (r *JSONRenderer) RenderCacheCleanup(cleanup CacheCleanup) error {
+	return r.e.Encode(cleanup)
+}
+
+func (r *JSONRenderer) RenderCacheProblems(problems []CacheProblem) error {
+	return r.e.Encode(problems)
+}
+
+func (r *JSONRenderer) RenderPrefetchResult(result PrefetchResult) error {
+	return r.e.Encode(result)
+}
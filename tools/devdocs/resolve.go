@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultDocsetAliases are the short names devdocs.io accepts for popular
+// docsets, keyed by alias. Values are docset names, not slugs, so an alias
+// resolves to whichever release of the docset is requested.
+var DefaultDocsetAliases = map[string]string{
+	"$":      "jquery",
+	"_":      "lodash",
+	"cr":     "crystal",
+	"cs":     "coffeescript",
+	"ex":     "elixir",
+	"golang": "go",
+	"java":   "openjdk",
+	"jl":     "julia",
+	"js":     "javascript",
+	"k8s":    "kubernetes",
+	"md":     "markdown",
+	"mpl":    "matplotlib",
+	"ng":     "angular",
+	"ngx":    "nginx",
+	"np":     "numpy",
+	"pd":     "pandas",
+	"pg":     "postgresql",
+	"py":     "python",
+	"rb":     "ruby",
+	"ror":    "ruby on rails",
+	"rs":     "rust",
+	"scss":   "sass",
+	"tf":     "tensorflow",
+	"ts":     "typescript",
+}
+
+// LatestRelease is the version that selects the newest release of a docset.
+const LatestRelease = "latest"
+
+// DocsetResolver turns the names users type into DevDocs docsets. It accepts
+// exact slugs ("python~3.12"), names and aliases ("python", "py"), and either
+// of those with a version ("py@3.12", "react@latest").
+type DocsetResolver struct {
+	Aliases map[string]string
+}
+
+func NewDocsetResolver(aliases map[string]string) *DocsetResolver {
+	return &DocsetResolver{Aliases: aliases}
+}
+
+var DefaultDocsetResolver = NewDocsetResolver(DefaultDocsetAliases)
+
+// Resolve finds the docset in docsets that query refers to. Without a
+// version, an exact slug wins over the newest release with a matching name.
+func (r *DocsetResolver) Resolve(docsets []Docset, query string) (Docset, error) {
+	name, version, hasVersion := strings.Cut(query, "@")
+
+	if !hasVersion {
+		for _, d := range docsets {
+			if d.Slug == query {
+				return d, nil
+			}
+		}
+	}
+
+	versions := r.Versions(docsets, name)
+	if len(versions) == 0 {
+		return Docset{}, fmt.Errorf("searched for docset %q: %w", query, ErrNotFound)
+	}
+
+	if version == "" || version == LatestRelease {
+		return versions[0], nil
+	}
+
+	// Prefer an exact release, then the newest release within the requested
+	// one, e.g. "3" matches "3.12".
+	for _, d := range versions {
+		if d.Release == version || d.Slug == slugName(d.Slug)+"~"+version {
+			return d, nil
+		}
+	}
+
+	for _, d := range versions {
+		if strings.HasPrefix(d.Release, version+".") {
+			return d, nil
+		}
+	}
+
+	return Docset{}, fmt.Errorf("searched for release %q of docset %q: %w", version, name, ErrNotFound)
+}
+
+// Versions returns every release of the named docset, newest first. The name
+// may be an alias, a docset name, or a slug without its version.
+func (r *DocsetResolver) Versions(docsets []Docset, name string) []Docset {
+	name = strings.ToLower(name)
+	if alias, ok := r.Aliases[name]; ok {
+		name = alias
+	}
+
+	versions := make([]Docset, 0)
+	seen := make(map[string]bool)
+	for _, d := range docsets {
+		if seen[d.Slug] {
+			continue
+		}
+
+		if strings.ToLower(d.Name) == name || slugName(d.Slug) == name {
+			versions = append(versions, d)
+			seen[d.Slug] = true
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareReleases(versions[i].Release, versions[j].Release) > 0
+	})
+
+	return versions
+}
+
+// slugName strips the version from a slug, e.g. "python~3.12" -> "python".
+func slugName(slug string) string {
+	name, _, _ := strings.Cut(slug, "~")
+	return name
+}
+
+// compareReleases compares two release strings, treating runs of digits as
+// numbers so that "3.10" is newer than "3.9".
+func compareReleases(a, b string) int {
+	ca, cb := splitRelease(a), splitRelease(b)
+
+	for i := 0; i < len(ca) && i < len(cb); i++ {
+		na, errA := strconv.Atoi(ca[i])
+		nb, errB := strconv.Atoi(cb[i])
+
+		var c int
+		if errA == nil && errB == nil {
+			c = na - nb
+		} else {
+			c = strings.Compare(ca[i], cb[i])
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	return len(ca) - len(cb)
+}
+
+func splitRelease(s string) []string {
+	chunks := make([]string, 0)
+
+	var cur strings.Builder
+	var digits bool
+	for _, r := range s {
+		isDigit := unicode.IsDigit(r)
+		if cur.Len() > 0 && isDigit != digits {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+
+		cur.WriteRune(r)
+		digits = isDigit
+	}
+
+	if cur.Len() > 0 {
+		chunks = append(chunks, cur.String())
+	}
+
+	return chunks
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrRateLimited means DevDocs responded with 429 Too Many Requests.
+	ErrRateLimited = errors.New("rate limited by DevDocs")
+	// ErrUnavailable means DevDocs responded with a server error, or the
+	// connection was refused or reset.
+	ErrUnavailable = errors.New("DevDocs is unavailable")
+	// ErrTimeout means a request to DevDocs took longer than the timeout.
+	ErrTimeout = errors.New("request to DevDocs timed out")
+)
+
+// RetryPolicy configures how failed requests are retried. Only transient
+// failures are retried: timeouts, refused or reset connections, 429 and 5xx
+// responses. The delay between retries doubles each time, with jitter, unless
+// DevDocs asks for a specific delay with a Retry-After header.
+type RetryPolicy struct {
+	Limit    int           `help:"How many times to retry failed requests" default:"3" env:"LIMIT"`
+	Delay    time.Duration `help:"How long to wait before the first retry" default:"500ms" env:"DELAY"`
+	MaxDelay time.Duration `help:"The longest to wait between retries" default:"10s" env:"MAX_DELAY"`
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Limit:    3,
+	Delay:    500 * time.Millisecond,
+	MaxDelay: 10 * time.Second,
+}
+
+// backoff returns how long to wait before the given retry (starting at 0).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.Delay
+	for i := 0; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	d = min(d, p.MaxDelay)
+	if d <= 0 {
+		return 0
+	}
+
+	// Wait somewhere between half and all of the delay, so that clients
+	// that failed together don't retry together.
+	return d/2 + rand.N(d/2+1)
+}
+
+// wait sleeps before the given retry. It returns false if the retry should
+// not happen, because the context is done or DevDocs asked to wait longer
+// than the maximum delay.
+func (p RetryPolicy) wait(ctx context.Context, retry int, retryAfter time.Duration) bool {
+	d := p.backoff(retry)
+	if retryAfter > 0 {
+		if retryAfter > p.MaxDelay {
+			return false
+		}
+
+		d = retryAfter
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// statusError classifies an HTTP error response. It returns nil for
+// successful responses.
+func statusError(res *http.Response) error {
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 400:
+		return nil
+	case res.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case res.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s", ErrRateLimited, res.Status)
+	case res.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", ErrUnavailable, res.Status)
+	default:
+		return fmt.Errorf("received HTTP error from DevDocs: %s", res.Status)
+	}
+}
+
+// transportError classifies an error from sending a request. The original
+// error stays in the chain, so it still matches *url.Error.
+func transportError(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, io.EOF):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	default:
+		return err
+	}
+}
+
+// isRetryable reports whether a request that failed with err might succeed
+// if it is tried again.
+func isRetryable(err error) bool {
+	return errors.Is(err, ErrTimeout) ||
+		errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, ErrRateLimited)
+}
+
+// parseRetryAfter reads the Retry-After header, which is either a number of
+// seconds or an HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if s, err := strconv.Atoi(header); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		return max(t.Sub(now), 0)
+	}
+
+	return 0
+}
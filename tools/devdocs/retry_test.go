@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "missing", header: "", want: 0},
+		{name: "seconds", header: "5", want: 5 * time.Second},
+		{name: "zero seconds", header: "0", want: 0},
+		{name: "negative seconds", header: "-1", want: 0},
+		{name: "date", header: now.Add(30 * time.Second).Format(http.TimeFormat), want: 30 * time.Second},
+		{name: "past date", header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "invalid", header: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header, now); got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Limit: 10, Delay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		retry int
+		delay time.Duration
+	}{
+		{retry: 0, delay: 100 * time.Millisecond},
+		{retry: 1, delay: 200 * time.Millisecond},
+		{retry: 2, delay: 400 * time.Millisecond},
+		{retry: 3, delay: 800 * time.Millisecond},
+		{retry: 4, delay: time.Second},
+		{retry: 20, delay: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.retry), func(t *testing.T) {
+			// The jitter is random, so try enough times to be likely to
+			// hit both ends.
+			for range 100 {
+				d := p.backoff(tt.retry)
+				if d < tt.delay/2 || d > tt.delay {
+					t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.retry, d, tt.delay/2, tt.delay)
+				}
+			}
+		})
+	}
+
+	if d := (RetryPolicy{}).backoff(0); d != 0 {
+		t.Errorf("backoff(0) with no delay = %v, want 0", d)
+	}
+}
+
+func TestRetryPolicyWaitRetryAfterTooLong(t *testing.T) {
+	p := RetryPolicy{Limit: 1, Delay: time.Millisecond, MaxDelay: time.Second}
+
+	if p.wait(context.Background(), 0, time.Minute) {
+		t.Error("wait() = true for a Retry-After longer than MaxDelay, want false")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "rate limited", err: statusError(&http.Response{StatusCode: 429, Status: "429 Too Many Requests"}), want: true},
+		{name: "server error", err: statusError(&http.Response{StatusCode: 503, Status: "503 Service Unavailable"}), want: true},
+		{name: "not found", err: statusError(&http.Response{StatusCode: 404, Status: "404 Not Found"}), want: false},
+		{name: "forbidden", err: statusError(&http.Response{StatusCode: 403, Status: "403 Forbidden"}), want: false},
+		{name: "connection refused", err: transportError(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)), want: true},
+		{name: "timeout", err: fmt.Errorf("%w: slow", ErrTimeout), want: true},
+		{name: "canceled", err: transportError(context.Canceled), want: false},
+		{name: "other", err: errors.New("something else"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		wantErr    error
+		wantTries  int32
+	}{
+		{name: "rate limited then ok", statuses: []int{429, 200}, retryAfter: "1", wantTries: 2},
+		{name: "unavailable then ok", statuses: []int{503, 503, 200}, wantTries: 3},
+		{name: "out of retries", statuses: []int{503, 503, 503, 503, 503}, wantErr: ErrUnavailable, wantTries: 4},
+		{name: "retry after too long", statuses: []int{429, 200}, retryAfter: "3600", wantErr: ErrRateLimited, wantTries: 1},
+		{name: "not found", statuses: []int{404, 200}, wantErr: ErrNotFound, wantTries: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tries atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := tries.Add(1)
+				status := tt.statuses[min(int(n), len(tt.statuses))-1]
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			c, err := NewClient(ClientOptions{
+				RootURL:      srv.URL,
+				DocumentsURL: srv.URL,
+				Retry:        RetryPolicy{Limit: 3, Delay: time.Millisecond, MaxDelay: 2 * time.Second},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := c.get(context.Background(), srv.URL, nil)
+			if err == nil {
+				res.Body.Close()
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("get() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if got := tries.Load(); got != tt.wantTries {
+				t.Errorf("get() made %d requests, want %d", got, tt.wantTries)
+			}
+		})
+	}
+}
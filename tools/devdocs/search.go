@@ -0,0 +1,228 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Search scores are tiered by the kind of match, so that e.g. every prefix
+// match ranks above every substring match. Within a tier, results are ranked
+// by a penalty that is always smaller than the gap between tiers.
+const (
+	scoreExact       = 6000
+	scorePrefix      = 5000
+	scoreBoundary    = 4000
+	scoreSubstring   = 3000
+	scoreWords       = 2000
+	scoreSubsequence = 1000
+	maxScorePenalty  = 999
+)
+
+// SearchResult is an entry that matched a search query.
+type SearchResult struct {
+	Docset string `json:"docset"`
+	*Entry
+	Score int `json:"score"`
+}
+
+var searchSeparators = strings.NewReplacer(
+	"::", ".",
+	"->", ".",
+	"#", ".",
+	":", ".",
+	" ", ".",
+)
+
+// normalizeSearchText lowercases s and turns the separators used across
+// languages (spaces, colons, arrows, etc.) into dots, so that e.g.
+// "Array map" and "std::vector" compare like "array.map" and "std.vector".
+func normalizeSearchText(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = searchSeparators.Replace(s)
+
+	// Collapse runs of dots.
+	var b strings.Builder
+	b.Grow(len(s))
+	prev := rune(0)
+	for _, r := range s {
+		if r == '.' && prev == '.' {
+			continue
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+
+	return strings.Trim(b.String(), ".")
+}
+
+func isSearchWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func searchWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !isSearchWordRune(r)
+	})
+}
+
+// SearchQuery is a normalized search query, ready to be matched against
+// entry names.
+type SearchQuery struct {
+	norm  string
+	words []string
+	chars string
+}
+
+func NewSearchQuery(query string) SearchQuery {
+	norm := normalizeSearchText(query)
+	return SearchQuery{
+		norm:  norm,
+		words: searchWords(norm),
+		chars: strings.ReplaceAll(norm, ".", ""),
+	}
+}
+
+func (q SearchQuery) IsEmpty() bool {
+	return q.norm == ""
+}
+
+// Score ranks how well name matches the query, the way devdocs.io does:
+// exact matches first, then prefix matches, substring matches starting at a
+// word boundary, other substring matches, matches on the starts of words, and
+// finally subsequence matches. Higher is better. If name does not match at
+// all, ok is false.
+func (q SearchQuery) Score(name string) (score int, ok bool) {
+	if q.IsEmpty() {
+		return 0, false
+	}
+
+	n := normalizeSearchText(name)
+	extra := len(n) - len(q.norm)
+
+	if n == q.norm {
+		return scoreExact, true
+	}
+
+	if strings.HasPrefix(n, q.norm) {
+		return scorePrefix - penalty(extra), true
+	}
+
+	if i := strings.Index(n, q.norm); i >= 0 {
+		if isSearchBoundary(n, i) {
+			return scoreBoundary - penalty(i+extra), true
+		}
+
+		return scoreSubstring - penalty(i+extra), true
+	}
+
+	if skipped, ok := matchSearchWords(searchWords(n), q.words); ok {
+		return scoreWords - penalty(skipped*10+extra), true
+	}
+
+	if gaps, ok := matchSubsequence(n, q.chars); ok {
+		return scoreSubsequence - penalty(gaps*10+extra), true
+	}
+
+	return 0, false
+}
+
+func penalty(n int) int {
+	return max(0, min(n, maxScorePenalty))
+}
+
+func isSearchBoundary(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return !isSearchWordRune(r)
+}
+
+// matchSearchWords reports whether each query word is a prefix of a name
+// word, in order. It also returns the number of name words skipped over.
+func matchSearchWords(names []string, query []string) (skipped int, ok bool) {
+	if len(query) == 0 {
+		return 0, false
+	}
+
+	i := 0
+	for _, w := range names {
+		if i == len(query) {
+			break
+		}
+
+		if strings.HasPrefix(w, query[i]) {
+			i++
+		} else {
+			skipped++
+		}
+	}
+
+	return skipped, i == len(query)
+}
+
+// matchSubsequence reports whether the characters of query appear in s in
+// order. It also returns the number of characters in s between the first and
+// last matched characters that were not matched.
+func matchSubsequence(s string, query string) (gaps int, ok bool) {
+	if query == "" {
+		return 0, false
+	}
+
+	qr := []rune(query)
+	i := 0
+	started := false
+	for _, r := range s {
+		if i == len(qr) {
+			break
+		}
+
+		if r == qr[i] {
+			i++
+			started = true
+		} else if started {
+			gaps++
+		}
+	}
+
+	return gaps, i == len(qr)
+}
+
+// Search ranks the entries in the index by how well their names match the
+// query, best match first. Entries that do not match are left out.
+func (e *EntryIndex) Search(query SearchQuery) []SearchResult {
+	results := make([]SearchResult, 0)
+
+	for _, entry := range e.Entries() {
+		score, ok := query.Score(entry.Name)
+		if !ok {
+			continue
+		}
+
+		results = append(results, SearchResult{
+			Entry: entry,
+			Score: score,
+		})
+	}
+
+	sortSearchResults(results)
+	return results
+}
+
+func sortSearchResults(results []SearchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+
+		return a.Docset < b.Docset
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchQueryScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		entry string
+		tier  int
+	}{
+		{name: "exact", query: "str.rep", entry: "str.rep", tier: scoreExact},
+		{name: "prefix", query: "str.rep", entry: "str.replace", tier: scorePrefix},
+		{name: "word boundary", query: "str.rep", entry: "bytes.str.rep", tier: scoreBoundary},
+		{name: "substring", query: "str.rep", entry: "xstr.rep", tier: scoreSubstring},
+		{name: "words", query: "str.rep", entry: "String.prototype.replace", tier: scoreWords},
+		{name: "subsequence", query: "str.rep", entry: "strrepeat", tier: scoreSubsequence},
+		{name: "no match", query: "str.rep", entry: "replace", tier: 0},
+		{name: "uppercase query", query: "PRINTF", entry: "printf", tier: scoreExact},
+		{name: "uppercase entry", query: "printf", entry: "fmt.Printf", tier: scoreBoundary},
+		{name: "separators", query: "std vector", entry: "std::vector", tier: scoreExact},
+		{name: "arrows", query: "obj->method", entry: "obj.method", tier: scoreExact},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, ok := NewSearchQuery(tt.query).Score(tt.entry)
+			if tt.tier == 0 {
+				if ok {
+					t.Errorf("Score(%q) = %d, want no match", tt.entry, score)
+				}
+				return
+			}
+
+			if !ok || score > tt.tier || score <= tt.tier-1000 {
+				t.Errorf("Score(%q) = %d, %v, want a score in (%d, %d]", tt.entry, score, ok, tt.tier-1000, tt.tier)
+			}
+		})
+	}
+}
+
+func TestSearchQueryScoreIgnoresCase(t *testing.T) {
+	for _, entry := range []string{"fmt.Printf", "FMT.PRINTF", "fmt.printf"} {
+		lower, _ := NewSearchQuery("printf").Score(entry)
+		upper, _ := NewSearchQuery("PrintF").Score(entry)
+		if lower != upper {
+			t.Errorf("Score(%q) = %d for %q and %d for %q", entry, lower, "printf", upper, "PrintF")
+		}
+	}
+}
+
+func TestEntryIndexSearch(t *testing.T) {
+	idx := NewEntryIndex([]Entry{
+		{Name: "replace", Path: "replace"},
+		{Name: "strrepeat", Path: "strrepeat"},
+		{Name: "String.prototype.replace", Path: "string-replace"},
+		{Name: "xstr.rep", Path: "xstr-rep"},
+		{Name: "bytes.str.rep", Path: "bytes-str-rep"},
+		{Name: "str.replaceAll", Path: "str-replace-all"},
+		{Name: "str.replace", Path: "str-replace"},
+		{Name: "str.rep", Path: "str-rep"},
+	})
+
+	// Within a tier, shorter names rank first.
+	want := []string{
+		"str.rep",
+		"str.replace",
+		"str.replaceAll",
+		"bytes.str.rep",
+		"xstr.rep",
+		"String.prototype.replace",
+		"strrepeat",
+	}
+
+	var got []string
+	for _, r := range idx.Search(NewSearchQuery("str.rep")) {
+		got = append(got, r.Name)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// HeadingAnchor is a heading in the HTML of a document, which sections of its
+// Markdown are matched with to find their ids.
+type HeadingAnchor struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+// markdownHeading is a heading found in Markdown.
+type markdownHeading struct {
+	Level int
+	Text  string
+	// Line is the 1-based line the heading starts on.
+	Line int
+}
+
+var markdownParser = goldmark.DefaultParser()
+
+// markdownHeadings finds the headings in a Markdown document. It parses the
+// document properly, so lines in code blocks that look like headings are not
+// headings, and setext headings (underlined with === or ---) are.
+func markdownHeadings(md []byte) []markdownHeading {
+	doc := markdownParser.Parse(text.NewReader(md))
+	lines := lineOffsets(md)
+
+	headings := make([]markdownHeading, 0)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		h, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+
+		// Empty headings have no lines to place them by.
+		if h.Lines().Len() == 0 {
+			return ast.WalkSkipChildren, nil
+		}
+
+		headings = append(headings, markdownHeading{
+			Level: h.Level,
+			Text:  inlineText(h, md),
+			Line:  lineAt(lines, h.Lines().At(0).Start),
+		})
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	return headings
+}
+
+// inlineText returns the text of an inline node and its children, without
+// any markup. Escaped punctuation and character references are resolved,
+// except in code spans.
+func inlineText(n ast.Node, src []byte) string {
+	buf := new(strings.Builder)
+	ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Text:
+			value := n.Segment.Value(src)
+			if _, ok := n.Parent().(*ast.CodeSpan); !ok {
+				value = util.ResolveEntityNames(util.ResolveNumericReferences(util.UnescapePunctuations(value)))
+			}
+
+			buf.Write(value)
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	return buf.String()
+}
+
+// lineOffsets returns the offset that each line of src starts at.
+func lineOffsets(src []byte) []int {
+	offsets := []int{0}
+	for i, b := range src {
+		if b == '\n' {
+			offsets = append(offsets, i+1)
+		}
+	}
+
+	return offsets
+}
+
+// lineAt returns the 1-based line that offset is on.
+func lineAt(offsets []int, offset int) int {
+	return sort.SearchInts(offsets, offset+1)
+}
+
+// lineText returns the 1-based line n of src.
+func lineText(src []byte, n int) string {
+	offsets := lineOffsets(src)
+	if n < 1 || n > len(offsets) {
+		return ""
+	}
+
+	line := src[offsets[n-1]:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	return string(line)
+}
+
+// countLines counts lines the way [bufio.Scanner] does, so a final line
+// without a newline counts, but nothing after a final newline does.
+func countLines(src []byte) int {
+	n := bytes.Count(src, []byte("\n"))
+	if len(src) > 0 && src[len(src)-1] != '\n' {
+		n++
+	}
+
+	return n
+}
+
+// alignHeadings finds the anchor of each Markdown heading. Headings are
+// matched by their text, in order, so headings that only exist on one side
+// (such as ones the conversion dropped, or an h1 that became a paragraph)
+// don't throw off the rest. Headings without an anchor get an empty id.
+func alignHeadings(headings []markdownHeading, anchors []HeadingAnchor) []string {
+	a := make([]string, len(headings))
+	for i, h := range headings {
+		a[i] = normalizeHeading(h.Text)
+	}
+
+	b := make([]string, len(anchors))
+	for j, anc := range anchors {
+		b[j] = normalizeHeading(anc.Text)
+	}
+
+	ids := make([]string, len(headings))
+
+	// Usually most headings match, so the ones at either end that do are
+	// matched directly, which leaves a much smaller table to fill.
+	lo := 0
+	for lo < len(a) && lo < len(b) && a[lo] != "" && a[lo] == b[lo] {
+		ids[lo] = anchors[lo].ID
+		lo++
+	}
+
+	hiA, hiB := len(a), len(b)
+	for hiA > lo && hiB > lo && a[hiA-1] != "" && a[hiA-1] == b[hiB-1] {
+		ids[hiA-1] = anchors[hiB-1].ID
+		hiA--
+		hiB--
+	}
+
+	for i, j := range longestCommonSubsequence(a[lo:hiA], b[lo:hiB]) {
+		if j >= 0 {
+			ids[lo+i] = anchors[lo+j].ID
+		}
+	}
+
+	return ids
+}
+
+// longestCommonSubsequence matches the strings of a with those of b by their longest
+// common subsequence. It returns the index in b of each string of a, or -1 if
+// it has no match. Empty strings never match.
+func longestCommonSubsequence(a []string, b []string) []int {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] != "" && a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] != "" && a[i] == b[j]:
+			matches[i] = j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return matches
+}
+
+// normalizeHeading reduces the text of a heading to its letters and digits,
+// in lower case, so that escaping, entities and punctuation added or dropped
+// by the conversion don't matter.
+func normalizeHeading(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+
+		return -1
+	}, html.UnescapeString(s))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarkdownHeadings(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want []markdownHeading
+	}{
+		{
+			name: "atx",
+			md:   "# One\n\ntext\n\n## Two *em*\n",
+			want: []markdownHeading{
+				{Level: 1, Text: "One", Line: 1},
+				{Level: 2, Text: "Two em", Line: 5},
+			},
+		},
+		{
+			name: "fenced code",
+			md:   "# One\n\n```sh\n# not a heading\n```\n\n## Two\n",
+			want: []markdownHeading{
+				{Level: 1, Text: "One", Line: 1},
+				{Level: 2, Text: "Two", Line: 7},
+			},
+		},
+		{
+			name: "indented code",
+			md:   "# One\n\n    # not a heading\n\n## Two\n",
+			want: []markdownHeading{
+				{Level: 1, Text: "One", Line: 1},
+				{Level: 2, Text: "Two", Line: 5},
+			},
+		},
+		{
+			name: "setext",
+			md:   "One\n===\n\nTwo\n---\n\ntext\n",
+			want: []markdownHeading{
+				{Level: 1, Text: "One", Line: 1},
+				{Level: 2, Text: "Two", Line: 4},
+			},
+		},
+		{
+			name: "escapes and entities",
+			md:   "## Set up &amp; go \\*now*\n",
+			want: []markdownHeading{
+				{Level: 2, Text: "Set up & go *now*", Line: 1},
+			},
+		},
+		{
+			name: "empty heading",
+			md:   "#\n\n## Two\n",
+			want: []markdownHeading{
+				{Level: 2, Text: "Two", Line: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := markdownHeadings([]byte(tt.md))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("markdownHeadings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlignHeadings(t *testing.T) {
+	tests := []struct {
+		name     string
+		headings []string
+		anchors  []string
+		want     []string
+	}{
+		{
+			name:     "same headings",
+			headings: []string{"One", "Two", "Three"},
+			anchors:  []string{"One", "Two", "Three"},
+			want:     []string{"id-One", "id-Two", "id-Three"},
+		},
+		{
+			name:     "heading missing from Markdown",
+			headings: []string{"One", "Three"},
+			anchors:  []string{"One", "Two", "Three"},
+			want:     []string{"id-One", "id-Three"},
+		},
+		{
+			name:     "heading missing from HTML",
+			headings: []string{"One", "Two", "Three"},
+			anchors:  []string{"One", "Three"},
+			want:     []string{"id-One", "", "id-Three"},
+		},
+		{
+			name:     "different headings in the middle",
+			headings: []string{"One", "Two", "Four", "Five"},
+			anchors:  []string{"One", "Three", "Four", "Five"},
+			want:     []string{"id-One", "", "id-Four", "id-Five"},
+		},
+		{
+			name:     "punctuation and entities",
+			headings: []string{"func (\\*T) Len()", "A & B"},
+			anchors:  []string{"func (*T) Len()", "A &amp; B"},
+			want:     []string{"id-func (*T) Len()", "id-A &amp; B"},
+		},
+		{
+			name:     "repeated headings",
+			headings: []string{"Example", "Example"},
+			anchors:  []string{"Example", "Other", "Example"},
+			want:     []string{"id-Example", "id-Example"},
+		},
+		{
+			name:     "empty headings never match",
+			headings: []string{"", "Two"},
+			anchors:  []string{"", "Two"},
+			want:     []string{"", "id-Two"},
+		},
+		{
+			name:     "no anchors",
+			headings: []string{"One"},
+			anchors:  nil,
+			want:     []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headings := make([]markdownHeading, len(tt.headings))
+			for i, text := range tt.headings {
+				headings[i] = markdownHeading{Level: 2, Text: text, Line: i + 1}
+			}
+
+			anchors := make([]HeadingAnchor, len(tt.anchors))
+			for i, text := range tt.anchors {
+				anchors[i] = HeadingAnchor{Level: 2, ID: "id-" + text, Text: text}
+			}
+
+			got := alignHeadings(headings, anchors)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("alignHeadings() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,27 +2,139 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
 )
 
+var ErrNoCache = errors.New("the cache is disabled")
+
 type Service struct {
-	client    *Client
+	// source reads docsets, entries and documents from the installed
+	// docsets, then any other sources, then the remotes.
+	source SourceChain
+	// local is source without the remotes.
+	local     SourceChain
+	remotes   Remotes
+	cache     *Cache
 	converter *MarkdownConverter
+	resolver  *DocsetResolver
 }
 
-func NewService(client *Client, converter *MarkdownConverter) *Service {
+// NewService creates a service that reads documentation from the docsets
+// installed in the cache, then from sources, then from the remotes. Docsets
+// are only ever installed from the remotes.
+func NewService(remotes Remotes, cache *Cache, converter *MarkdownConverter, sources ...Source) *Service {
+	local := make(SourceChain, 0, len(sources)+1)
+	if cache != nil {
+		local = append(local, NewInstalledSource(cache))
+	}
+	local = append(local, sources...)
+
+	chain := append(slices.Clip(local), remotes)
+
 	return &Service{
-		client:    client,
+		source:    chain,
+		local:     local,
+		remotes:   remotes,
+		cache:     cache,
 		converter: converter,
+		resolver:  DefaultDocsetResolver,
 	}
 }
 
 func (s *Service) ListDocsets(ctx context.Context) ([]Docset, error) {
-	return s.client.ListDocsets(ctx)
+	return s.source.ListDocsets(ctx)
+}
+
+// ResolveDocset finds the docset that a user-supplied name refers to, such as
+// an exact slug, an alias, or a name with a version (see [DocsetResolver]).
+// The installed docsets and those of the other sources are considered first,
+// so local docsets resolve without the network, and the remotes are only
+// listed when none of them match.
+func (s *Service) ResolveDocset(ctx context.Context, query string) (Docset, error) {
+	local, localErrs := listDocsets(ctx, s.local)
+	if d, err := s.resolver.Resolve(local, query); err == nil {
+		return d, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return Docset{}, fmt.Errorf("could not resolve docset %q: %w", query, err)
+	}
+
+	remote, remoteErrs := listDocsets(ctx, SourceChain{s.remotes})
+	errs := append(localErrs, remoteErrs...)
+
+	d, err := s.resolver.Resolve(append(local, remote...), query)
+	if err != nil && len(errs) > 0 {
+		return Docset{}, fmt.Errorf("could not resolve docset %q: %w", query, sourceError(errs))
+	} else if err != nil {
+		return Docset{}, fmt.Errorf("could not resolve docset %q: %w", query, err)
+	}
+
+	return d, nil
+}
+
+// listDocsets lists the docsets of every source, carrying on past the ones
+// that fail, so that a name resolves as long as a source that has it can be
+// reached.
+func listDocsets(ctx context.Context, sources SourceChain) ([]Docset, []error) {
+	docsets := make([]Docset, 0)
+
+	var errs []error
+	for _, src := range sources {
+		list, err := src.ListDocsets(ctx)
+		if err != nil {
+			slog.Debug("failed to list docsets from source", "err", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		docsets = append(docsets, list...)
+	}
+
+	return docsets, errs
+}
+
+// DocsetVersions returns every available release of the named docset,
+// newest first.
+func (s *Service) DocsetVersions(ctx context.Context, name string) ([]Docset, error) {
+	docsets, err := s.remotes.ListDocsets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not list versions of docset %q: %w", name, err)
+	}
+
+	versions := s.resolver.Versions(docsets, name)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("could not list versions of docset %q: %w", name, ErrNotFound)
+	}
+
+	return versions, nil
+}
+
+// resolveInstalled finds the installed docset that a user-supplied name
+// refers to, without the network.
+func (s *Service) resolveInstalled(ctx context.Context, query string) (string, error) {
+	installed, err := s.ListInstalledDocsets(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	d, err := s.resolver.Resolve(installed, query)
+	if errors.Is(err, ErrNotFound) {
+		return "", ErrNotInstalled
+	} else if err != nil {
+		return "", err
+	}
+
+	return d.Slug, nil
 }
 
 func (s *Service) ListEntries(ctx context.Context, docset string) ([]*Entry, error) {
-	idx, err := s.entryIndex(ctx, docset)
+	idx, _, err := s.entryIndex(ctx, docset)
 	if err != nil {
 		return nil, fmt.Errorf("could not list entries in docset %q: %w", docset, err)
 	}
@@ -30,48 +142,693 @@ func (s *Service) ListEntries(ctx context.Context, docset string) ([]*Entry, err
 	return idx.Entries(), nil
 }
 
-func (s *Service) ShowEntry(ctx context.Context, docset string, path string) (*EntryView, error) {
-	idx, err := s.entryIndex(ctx, docset)
+// ShowOptions selects what [Service.ShowEntry] shows of a document.
+type ShowOptions struct {
+	// Sections are ids or titles of sections to show, in addition to the
+	// fragment of the entry's path, if it has one (see
+	// [DocumentIndex.FindSection]).
+	Sections []string
+	// Shallow leaves the subsections out of each section.
+	Shallow bool
+}
+
+// ShowEntry shows the document of an entry, or an excerpt of the sections
+// selected by its fragment and opts. Sections are shown in document order.
+func (s *Service) ShowEntry(ctx context.Context, docset string, path string, opts ShowOptions) (*EntryView, error) {
+	idx, m, err := s.entryIndex(ctx, docset)
 	if err != nil {
 		return nil, fmt.Errorf("could not show entry %q in docset %q: %w", path, docset, err)
 	}
 
-	entry, ok := idx.Get(path)
-	if !ok {
+	var loc EntryLocator
+	if entry, ok := idx.Get(path); ok {
+		loc = NewEntryLocator(entry.Path)
+	} else if doc, ok := idx.FindDocument(path); ok && (len(opts.Sections) > 0 || NewEntryLocator(path).HasFragment()) {
+		// Sections of a document can be shown even if no entry points at
+		// them.
+		loc = doc
+		loc.Fragment = NewEntryLocator(path).Fragment
+	} else {
 		return nil, fmt.Errorf("no entry %q found in docset %q", path, docset)
 	}
 
-	loc := NewEntryLocator(entry.Path)
-	html, err := s.client.GetDocument(ctx, docset, loc)
+	if opts.Shallow && !loc.HasFragment() && len(opts.Sections) == 0 {
+		return nil, fmt.Errorf("could not show entry %q: a shallow excerpt needs a fragment or a section to show", path)
+	}
+
+	html, err := s.source.GetDocument(ctx, m.Docset, loc)
 	if err != nil {
 		return nil, fmt.Errorf("could not fetch document for entry %q: %w", path, err)
 	}
 
-	md, err := s.converter.Convert(html)
+	md, err := s.convert(html)
 	if err != nil {
 		return nil, fmt.Errorf("could not convert entry %q to Markdown: %w", path, err)
 	}
 
-	var view *EntryView
+	sections := make([]DocumentSection, 0, len(opts.Sections)+1)
 	if loc.HasFragment() {
-		lines, ok := md.Index.Get(loc.Fragment)
+		section, ok := md.Index.Section(loc.Fragment)
 		if !ok {
 			return nil, fmt.Errorf("searched for section %q in document %q: section not found", loc.Fragment, loc.Path)
 		}
 
-		view = NewExcerptView(md, lines)
-	} else {
-		view = NewDocumentView(md)
+		sections = append(sections, section)
+	}
+
+	for _, query := range opts.Sections {
+		section, ok := md.Index.FindSection(query)
+		if !ok {
+			return nil, fmt.Errorf("searched for section %q in document %q: section not found", query, loc.Path)
+		}
+
+		slog.Debug("found section", "query", query, "id", section.ID, "title", section.Title)
+		sections = append(sections, section)
+	}
+
+	if len(sections) == 0 {
+		return NewDocumentView(md), nil
+	}
+
+	if opts.Shallow {
+		for i, section := range sections {
+			sections[i].Lines = md.Index.Shallow(section)
+		}
+	}
+
+	return NewExcerptView(md, sections), nil
+}
+
+// OutlineDocument lists the sections of the document at path, which may be
+// the path of any entry in the document.
+func (s *Service) OutlineDocument(ctx context.Context, docset string, path string) (*DocumentOutline, error) {
+	idx, m, err := s.entryIndex(ctx, docset)
+	if err != nil {
+		return nil, fmt.Errorf("could not outline document %q in docset %q: %w", path, docset, err)
+	}
+
+	loc, ok := idx.FindDocument(path)
+	if !ok {
+		return nil, fmt.Errorf("no document %q found in docset %q", path, docset)
+	}
+
+	html, err := s.source.GetDocument(ctx, m.Docset, loc)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch document %q: %w", loc.Path, err)
+	}
+
+	md, err := s.convert(html)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert document %q to Markdown: %w", loc.Path, err)
+	}
+
+	return NewDocumentOutline(md), nil
+}
+
+// Search ranks the entries in one or more docsets by how well their names
+// match the query, merging the results into a single list. If limit is
+// positive, at most limit results are returned. Docsets that could not be
+// searched are reported in the returned error, alongside the results from
+// the others.
+func (s *Service) Search(ctx context.Context, docsets []string, query string, limit int) ([]SearchResult, error) {
+	q := NewSearchQuery(query)
+	if q.IsEmpty() {
+		return nil, errors.New("could not search: empty query")
+	}
+
+	if len(docsets) == 0 {
+		return nil, errors.New("could not search: no docsets to search")
+	}
+
+	found := make([][]SearchResult, len(docsets))
+	errs := make([]error, len(docsets))
+
+	var wg sync.WaitGroup
+	for i, docset := range docsets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			idx, m, err := s.entryIndex(ctx, docset)
+			if err != nil {
+				errs[i] = fmt.Errorf("could not search docset %q: %w", docset, err)
+				return
+			}
+
+			results := idx.Search(q)
+			for j := range results {
+				results[j].Docset = m.Docset
+			}
+			found[i] = results
+		}()
+	}
+	wg.Wait()
+
+	results := make([]SearchResult, 0)
+	for _, r := range found {
+		results = append(results, r...)
+	}
+
+	sortSearchResults(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// InstallDocset downloads a docset in its entirety, so that its entries and
+// documents are available without the network.
+func (s *Service) InstallDocset(ctx context.Context, name string) (DocsetChange, error) {
+	change := DocsetChange{
+		Action: DocsetInstalled,
+		Slug:   name,
+	}
+
+	if s.cache == nil {
+		return change, fmt.Errorf("could not install docset %q: %w", name, ErrNoCache)
+	}
+
+	// Resolve against DevDocs only, since an existing installation may be
+	// out of date.
+	docsets, err := s.remotes.ListDocsets(ctx)
+	if err != nil {
+		return change, fmt.Errorf("could not install docset %q: %w", name, err)
+	}
+
+	d, err := s.resolver.Resolve(docsets, name)
+	if err != nil {
+		return change, fmt.Errorf("could not install docset %q: %w", name, err)
+	}
+
+	change.Slug = d.Slug
+	if prev := s.installed(d.Slug); prev != nil {
+		change.Previous = &prev.Docset
+	}
+
+	inst, err := s.install(ctx, d)
+	if err != nil {
+		return change, fmt.Errorf("could not install docset %q: %w", d.Slug, err)
+	}
+
+	change.Current = &inst.Docset
+	return change, nil
+}
+
+// ImportDocsets installs docsets from a directory, such as the public/docs
+// directory of a DevDocs checkout (see [DirSource]). If no slugs are given,
+// every docset in the directory is imported. Docsets that fail to import are
+// reported in the returned error, alongside the changes to the others.
+func (s *Service) ImportDocsets(ctx context.Context, dir string, slugs []string) ([]DocsetChange, error) {
+	changes := make([]DocsetChange, 0, len(slugs))
+
+	if s.cache == nil {
+		return changes, fmt.Errorf("could not import docsets: %w", ErrNoCache)
+	}
+
+	src := NewDirSource(dir)
+	docsets, err := src.ListDocsets(ctx)
+	if err != nil {
+		return changes, fmt.Errorf("could not import docsets from %q: %w", dir, err)
+	}
+
+	if len(slugs) == 0 {
+		for _, d := range docsets {
+			slugs = append(slugs, d.Slug)
+		}
+	}
+
+	if len(slugs) == 0 {
+		return changes, fmt.Errorf("could not import docsets from %q: no docsets found", dir)
+	}
+
+	var errs []error
+	for _, query := range slugs {
+		d, err := s.resolver.Resolve(docsets, query)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not import docset %q: %w", query, err))
+			continue
+		}
+
+		change, err := s.importDocset(ctx, src, d)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not import docset %q: %w", d.Slug, err))
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+func (s *Service) importDocset(ctx context.Context, src *DirSource, d Docset) (DocsetChange, error) {
+	change := DocsetChange{
+		Action: DocsetInstalled,
+		Slug:   d.Slug,
+	}
+
+	if prev := s.installed(d.Slug); prev != nil {
+		change.Previous = &prev.Docset
+	}
+
+	index, err := src.ReadIndex(d.Slug)
+	if err != nil {
+		return change, err
+	}
+
+	db, err := src.ReadDatabase(ctx, d.Slug)
+	if err != nil {
+		return change, err
+	}
+
+	inst, err := s.cache.InstallDocset(d, index, db)
+	if err != nil {
+		return change, err
+	}
+
+	change.Current = &inst.Docset
+	return change, nil
+}
+
+// ListInstalledDocsets returns the docsets installed for offline use.
+func (s *Service) ListInstalledDocsets(ctx context.Context) ([]Docset, error) {
+	list := make([]Docset, 0)
+	if s.cache == nil {
+		return list, nil
+	}
+
+	installed, err := s.cache.InstalledDocsets()
+	if err != nil {
+		return list, fmt.Errorf("could not list installed docsets: %w", err)
+	}
+
+	for _, i := range installed {
+		list = append(list, i.Docset)
+	}
+
+	return list, nil
+}
+
+// UpdateDocsets reinstalls every given docset that DevDocs has rebuilt since
+// it was installed. If no slugs are given, every installed docset is checked.
+// Docsets that fail to update are reported in the returned error, alongside
+// the changes to the others.
+func (s *Service) UpdateDocsets(ctx context.Context, slugs []string) ([]DocsetChange, error) {
+	changes := make([]DocsetChange, 0, len(slugs))
+
+	if s.cache == nil {
+		return changes, fmt.Errorf("could not update docsets: %w", ErrNoCache)
+	}
+
+	if len(slugs) == 0 {
+		installed, err := s.cache.InstalledDocsets()
+		if err != nil {
+			return changes, fmt.Errorf("could not update docsets: %w", err)
+		}
+
+		for _, i := range installed {
+			slugs = append(slugs, i.Slug)
+		}
+	}
+
+	docsets, err := s.remotes.Revalidating().ListDocsets(ctx)
+	if err != nil {
+		return changes, fmt.Errorf("could not update docsets: %w", err)
+	}
+
+	latest := make(map[string]Docset, len(docsets))
+	for _, d := range docsets {
+		latest[d.Slug] = d
 	}
 
-	return view, err
+	var errs []error
+	for _, query := range slugs {
+		slug, err := s.resolveInstalled(ctx, query)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not update docset %q: %w", query, err))
+			continue
+		}
+
+		change, err := s.updateDocset(ctx, slug, latest)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not update docset %q: %w", slug, err))
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+func (s *Service) updateDocset(ctx context.Context, slug string, latest map[string]Docset) (DocsetChange, error) {
+	change := DocsetChange{
+		Slug: slug,
+	}
+
+	prev, err := s.cache.InstalledDocset(slug)
+	if isCacheMiss(err) {
+		return change, ErrNotInstalled
+	} else if err != nil {
+		return change, err
+	}
+
+	d, ok := latest[slug]
+	if !ok {
+		return change, fmt.Errorf("searched for docset with slug %q: %w", slug, ErrNotFound)
+	}
+
+	change.Previous = &prev.Docset
+	if !prev.IsOutdated(d) {
+		change.Action = DocsetUnchanged
+		change.Current = &prev.Docset
+		return change, nil
+	}
+
+	inst, err := s.install(ctx, d)
+	if err != nil {
+		return change, err
+	}
+
+	change.Action = DocsetUpdated
+	change.Current = &inst.Docset
+	return change, nil
 }
 
-func (s *Service) entryIndex(ctx context.Context, docset string) (*EntryIndex, error) {
-	m, err := s.client.ListEntries(ctx, docset)
+// UninstallDocset removes an installed docset and its previous installation.
+func (s *Service) UninstallDocset(ctx context.Context, name string) (DocsetChange, error) {
+	change := DocsetChange{
+		Action: DocsetUninstalled,
+		Slug:   name,
+	}
+
+	if s.cache == nil {
+		return change, fmt.Errorf("could not uninstall docset %q: %w", name, ErrNoCache)
+	}
+
+	slug, err := s.resolveInstalled(ctx, name)
+	if err != nil {
+		return change, fmt.Errorf("could not uninstall docset %q: %w", name, err)
+	}
+	change.Slug = slug
+
+	inst, err := s.cache.UninstallDocset(slug)
+	if err != nil {
+		return change, fmt.Errorf("could not uninstall docset %q: %w", slug, err)
+	}
+
+	change.Previous = &inst.Docset
+	return change, nil
+}
+
+// RollbackDocset restores the installation of a docset that was replaced by
+// its most recent update.
+func (s *Service) RollbackDocset(ctx context.Context, name string) (DocsetChange, error) {
+	change := DocsetChange{
+		Action: DocsetRolledBack,
+		Slug:   name,
+	}
+
+	if s.cache == nil {
+		return change, fmt.Errorf("could not roll back docset %q: %w", name, ErrNoCache)
+	}
+
+	slug, err := s.resolveInstalled(ctx, name)
+	if err != nil {
+		return change, fmt.Errorf("could not roll back docset %q: %w", name, err)
+	}
+	change.Slug = slug
+
+	from, to, err := s.cache.RollbackDocset(slug)
 	if err != nil {
-		return nil, fmt.Errorf("could not index entries in docset %q: %w", docset, err)
+		return change, fmt.Errorf("could not roll back docset %q: %w", slug, err)
+	}
+
+	change.Previous = &from.Docset
+	change.Current = &to.Docset
+	return change, nil
+}
+
+func (s *Service) install(ctx context.Context, d Docset) (*InstalledDocset, error) {
+	index, err := s.remotes.DownloadIndex(ctx, d.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := s.remotes.DownloadDatabase(ctx, d.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.cache.InstallDocset(d, index, db)
+}
+
+// convert converts a document to Markdown, reusing the result of an earlier
+// conversion from the cache if possible.
+func (s *Service) convert(html *HTMLDocument) (*MarkdownDocument, error) {
+	if s.cache == nil {
+		return s.converter.Convert(html)
+	}
+
+	key := s.converter.CacheKey(html)
+	md, err := s.cachedMarkdown(html, key)
+	if err == nil {
+		slog.Debug("using cached Markdown", "key", key)
+		return md, nil
+	} else if !isCacheMiss(err) {
+		slog.Debug("failed to read Markdown from cache", "key", key, "err", err)
+	}
+
+	md, err = s.converter.Convert(html)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := md.Index.MarshalText()
+	if err != nil {
+		slog.Debug("failed to serialize document index", "key", key, "err", err)
+		return md, nil
+	}
+
+	meta := CacheMeta{FetchedAt: time.Now()}
+	if err := s.cache.Put(ResourceMarkdown, key+".md", md.Content, meta); err != nil {
+		slog.Debug("failed to write Markdown to cache", "key", key, "err", err)
+	} else if err := s.cache.Put(ResourceMarkdown, key+".index", idx, meta); err != nil {
+		slog.Debug("failed to write Markdown to cache", "key", key, "err", err)
+	}
+
+	return md, nil
+}
+
+func (s *Service) cachedMarkdown(html *HTMLDocument, key string) (*MarkdownDocument, error) {
+	// The index is written last, so its presence means the Markdown is
+	// complete.
+	rawIdx, err := s.cache.Get(ResourceMarkdown, key+".index")
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := s.cache.Get(ResourceMarkdown, key+".md")
+	if err != nil {
+		return nil, err
+	}
+
+	idx := new(DocumentIndex)
+	if err := idx.UnmarshalText(rawIdx.Data); err != nil {
+		return nil, err
+	}
+
+	return NewMarkdownDocumentFromHTML(html, content.Data, idx), nil
+}
+
+// installed returns the installed docset with the given slug, or nil if it
+// is not installed.
+func (s *Service) installed(slug string) *InstalledDocset {
+	if s.cache == nil {
+		return nil
+	}
+
+	inst, err := s.cache.InstalledDocset(slug)
+	if err != nil {
+		if !isCacheMiss(err) {
+			slog.Debug("failed to read installed docset", "slug", slug, "err", err)
+		}
+		return nil
+	}
+
+	return inst
+}
+
+// entryIndex resolves a docset and indexes its entries. The manifest's
+// Docset field holds the resolved slug.
+func (s *Service) entryIndex(ctx context.Context, docset string) (*EntryIndex, EntryManifest, error) {
+	var m EntryManifest
+
+	d, err := s.ResolveDocset(ctx, docset)
+	if err != nil {
+		return nil, m, err
+	}
+
+	m, err = s.source.ListEntries(ctx, d.Slug)
+	if err != nil {
+		return nil, m, fmt.Errorf("could not index entries in docset %q: %w", d.Slug, err)
+	}
+
+	return NewEntryIndex(m.Entries), m, nil
+}
+
+// ServeMirror serves the installed docsets over HTTP on addr (see [Mirror])
+// until ctx is canceled.
+func (s *Service) ServeMirror(ctx context.Context, addr string) error {
+	if s.cache == nil {
+		return fmt.Errorf("could not serve mirror: %w", ErrNoCache)
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not serve mirror: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           NewMirror(s.cache),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Debug("failed to shut down mirror", "err", err)
+		}
+	})
+	defer stop()
+
+	slog.Info("serving installed docsets", "url", "http://"+ln.Addr().String()+"/")
+	err = server.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return fmt.Errorf("could not serve mirror: %w", err)
+}
+
+// CacheStats reports how much space the cache uses.
+func (s *Service) CacheStats(ctx context.Context) (*CacheStats, error) {
+	if s.cache == nil {
+		return nil, fmt.Errorf("could not read cache stats: %w", ErrNoCache)
+	}
+
+	stats, err := s.cache.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("could not read cache stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// PruneCache removes unusable and least recently used resources from the
+// cache, until it fits in maxSize bytes.
+func (s *Service) PruneCache(ctx context.Context, maxSize int64) (CacheCleanup, error) {
+	if s.cache == nil {
+		return CacheCleanup{}, fmt.Errorf("could not prune cache: %w", ErrNoCache)
+	}
+
+	cleanup, err := s.cache.Prune(maxSize, s.converter.Fingerprint())
+	if err != nil {
+		return cleanup, fmt.Errorf("could not prune cache: %w", err)
+	}
+
+	return cleanup, nil
+}
+
+// ClearCache removes every cached resource, and installed docsets if all is
+// true.
+func (s *Service) ClearCache(ctx context.Context, all bool) (CacheCleanup, error) {
+	if s.cache == nil {
+		return CacheCleanup{}, fmt.Errorf("could not clear cache: %w", ErrNoCache)
+	}
+
+	cleanup, err := s.cache.Clear(all)
+	if err != nil {
+		return cleanup, fmt.Errorf("could not clear cache: %w", err)
+	}
+
+	return cleanup, nil
+}
+
+// VerifyCache finds corrupt files in the cache. Unless dryRun is true, they
+// are repaired: corrupt resources are deleted, so they are fetched again
+// when needed, and corrupt installations are downloaded again. Problems that
+// could not be repaired are reported in the returned error.
+func (s *Service) VerifyCache(ctx context.Context, dryRun bool) ([]CacheProblem, error) {
+	if s.cache == nil {
+		return nil, fmt.Errorf("could not verify cache: %w", ErrNoCache)
+	}
+
+	problems, err := s.cache.Verify()
+	if err != nil {
+		return problems, fmt.Errorf("could not verify cache: %w", err)
+	}
+
+	if dryRun {
+		return problems, nil
+	}
+
+	var errs []error
+	for i, p := range problems {
+		var err error
+		switch p.Kind {
+		case ResourceInstalled:
+			err = s.reinstall(ctx, p)
+			if err == nil {
+				problems[i].Repair = CacheReinstalled
+			}
+		default:
+			err = s.cache.RemoveCorrupt(p)
+			if err == nil {
+				problems[i].Repair = CacheDeleted
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not repair %q: %w", p.Path, err))
+		}
+	}
+
+	return problems, errors.Join(errs...)
+}
+
+// reinstall replaces a corrupt installation with a fresh download of the
+// same docset. The previous installation is left alone.
+func (s *Service) reinstall(ctx context.Context, p CacheProblem) error {
+	slug := p.Docset
+
+	docsets, err := s.remotes.ListDocsets(ctx)
+	if err != nil {
+		return err
+	}
+
+	i := slices.IndexFunc(docsets, func(d Docset) bool { return d.Slug == slug })
+	if i < 0 {
+		return fmt.Errorf("searched for docset with slug %q: %w", slug, ErrNotFound)
+	}
+
+	index, err := s.remotes.DownloadIndex(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	db, err := s.remotes.DownloadDatabase(ctx, slug)
+	if err != nil {
+		return err
+	}
+
+	if err := s.cache.RemoveCorrupt(p); err != nil {
+		return err
 	}
 
-	return NewEntryIndex(m.Entries), nil
+	_, err = s.cache.InstallDocset(docsets[i], index, db)
+	return err
 }
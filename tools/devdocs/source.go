@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+)
+
+// Source provides documentation: the docsets it knows of, their entries and
+// their documents. Sources that don't have a docset or document return
+// [ErrNotFound], so that a [SourceChain] can try the next one.
+//
+// [*Client] and [Remotes] are sources that fetch from DevDocs over HTTP.
+type Source interface {
+	ListDocsets(ctx context.Context) ([]Docset, error)
+	ListEntries(ctx context.Context, docset string) (EntryManifest, error)
+	GetDocument(ctx context.Context, docset string, entry EntryLocator) (*HTMLDocument, error)
+}
+
+// SourceChain is a list of sources in order of priority. Like [Remotes], it
+// lists the docsets of every source, and reads entries and documents from the
+// first source that has them.
+type SourceChain []Source
+
+func (c SourceChain) ListDocsets(ctx context.Context) ([]Docset, error) {
+	list := make([]Docset, 0)
+	seen := make(map[string]bool)
+
+	var errs []error
+	var ok bool
+	for _, src := range c {
+		docsets, err := src.ListDocsets(ctx)
+		if err != nil {
+			if !shouldFallBack(err) {
+				return list, err
+			}
+
+			slog.Debug("failed to list docsets from source", "err", err)
+			errs = append(errs, err)
+			continue
+		}
+
+		ok = true
+		for _, d := range docsets {
+			if !seen[d.Slug] {
+				list = append(list, d)
+				seen[d.Slug] = true
+			}
+		}
+	}
+
+	if !ok {
+		return list, sourceError(errs)
+	}
+
+	return list, nil
+}
+
+func (c SourceChain) ListEntries(ctx context.Context, docset string) (EntryManifest, error) {
+	return firstSource(c, func(src Source) (EntryManifest, error) {
+		return src.ListEntries(ctx, docset)
+	})
+}
+
+func (c SourceChain) GetDocument(ctx context.Context, docset string, entry EntryLocator) (*HTMLDocument, error) {
+	return firstSource(c, func(src Source) (*HTMLDocument, error) {
+		return src.GetDocument(ctx, docset, entry)
+	})
+}
+
+// RateLimited returns a copy of the chain whose HTTP sources share the rate
+// limiter l. Other sources are left as they are.
+func (c SourceChain) RateLimited(l *rateLimiter) SourceChain {
+	cp := make(SourceChain, len(c))
+	for i, src := range c {
+		switch src := src.(type) {
+		case Remotes:
+			cp[i] = src.RateLimited(l)
+		case *Client:
+			cp[i] = src.RateLimited(l)
+		case SourceChain:
+			cp[i] = src.RateLimited(l)
+		default:
+			cp[i] = src
+		}
+	}
+
+	return cp
+}
+
+func firstSource[T any](c SourceChain, f func(src Source) (T, error)) (T, error) {
+	var errs []error
+	for _, src := range c {
+		v, err := f(src)
+		if err == nil {
+			return v, nil
+		}
+
+		if !shouldFallBack(err) {
+			return v, err
+		}
+
+		errs = append(errs, err)
+	}
+
+	var zero T
+	if len(errs) == 0 {
+		return zero, errors.New("no sources configured")
+	}
+
+	return zero, sourceError(errs)
+}
+
+// sourceError combines the errors from every source in a chain. A source
+// that doesn't have a resource is the least interesting reason for a failure,
+// so those errors are dropped in favor of any others.
+func sourceError(errs []error) error {
+	var failed []error
+	for _, err := range errs {
+		if !errors.Is(err, ErrNotFound) {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(failed) == 0 {
+		return errs[len(errs)-1]
+	}
+
+	return errors.Join(failed...)
+}
+
+// InstalledSource reads docsets installed in a cache.
+type InstalledSource struct {
+	cache *Cache
+}
+
+func NewInstalledSource(cache *Cache) *InstalledSource {
+	return &InstalledSource{cache: cache}
+}
+
+func (s *InstalledSource) ListDocsets(ctx context.Context) ([]Docset, error) {
+	list := make([]Docset, 0)
+
+	installed, err := s.cache.InstalledDocsets()
+	if err != nil {
+		return list, err
+	}
+
+	for _, i := range installed {
+		list = append(list, i.Docset)
+	}
+
+	return list, nil
+}
+
+func (s *InstalledSource) ListEntries(ctx context.Context, docset string) (EntryManifest, error) {
+	inst, err := s.installed(docset)
+	if err != nil {
+		return EntryManifest{}, err
+	}
+
+	return inst.Manifest()
+}
+
+func (s *InstalledSource) GetDocument(ctx context.Context, docset string, entry EntryLocator) (*HTMLDocument, error) {
+	inst, err := s.installed(docset)
+	if err != nil {
+		return nil, err
+	}
+
+	return inst.GetDocument(entry)
+}
+
+func (s *InstalledSource) installed(docset string) (*InstalledDocset, error) {
+	inst, err := s.cache.InstalledDocset(docset)
+	if isCacheMiss(err) {
+		return nil, fmt.Errorf("searched for installed docset %q: %w", docset, ErrNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return inst, nil
+}
+
+// DirSource reads docsets from a directory laid out like the URLs that
+// [Client] fetches from:
+//
+//	docs.json
+//	<slug>/index.json
+//	<slug>/<path>.html
+//
+// It also reads the public/docs directory of a DevDocs checkout, where
+// `thor docs:download` leaves each docset's documents bundled in a db.json,
+// and describes the docset in a meta.json instead of docs.json:
+//
+//	<slug>/meta.json
+//	<slug>/index.json
+//	<slug>/db.json
+//
+// It serves custom docsets, and fixtures that stand in for DevDocs.
+type DirSource struct {
+	fsys fs.FS
+}
+
+// NewDirSource creates a source that reads from the directory dir.
+func NewDirSource(dir string) *DirSource {
+	return NewFSSource(os.DirFS(dir))
+}
+
+// NewFSSource creates a source that reads from fsys, laid out like the
+// directory of a [DirSource].
+func NewFSSource(fsys fs.FS) *DirSource {
+	return &DirSource{fsys: fsys}
+}
+
+func (s *DirSource) ListDocsets(ctx context.Context) ([]Docset, error) {
+	list := make([]Docset, 0)
+
+	data, err := s.readFile("docs.json")
+	if errors.Is(err, ErrNotFound) {
+		return s.listDocsetDirs()
+	} else if err != nil {
+		return list, err
+	}
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return list, fmt.Errorf("could not parse docs.json: %w", err)
+	}
+
+	return list, nil
+}
+
+// listDocsetDirs lists the docsets in a directory without a docs.json. Every
+// subdirectory with an index.json is a docset, described by its meta.json if
+// it has one.
+func (s *DirSource) listDocsetDirs() ([]Docset, error) {
+	list := make([]Docset, 0)
+
+	dirs, err := fs.ReadDir(s.fsys, ".")
+	if err != nil {
+		return list, err
+	}
+
+	for _, dir := range dirs {
+		slug := dir.Name()
+		if !dir.IsDir() {
+			continue
+		}
+
+		if _, err := fs.Stat(s.fsys, path.Join(slug, "index.json")); err != nil {
+			continue
+		}
+
+		d := Docset{Name: slug, Slug: slug}
+		meta, err := s.readFile(path.Join(slug, "meta.json"))
+		if err == nil {
+			err = json.Unmarshal(meta, &d)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			slog.Debug("failed to read docset metadata", "slug", slug, "err", err)
+		}
+
+		// DevDocs names docsets by their slug, whatever meta.json says.
+		d.Slug = slug
+		list = append(list, d)
+	}
+
+	return list, nil
+}
+
+func (s *DirSource) ListEntries(ctx context.Context, docset string) (EntryManifest, error) {
+	m := EntryManifest{
+		Entries: make([]Entry, 0),
+	}
+
+	data, err := s.readFile(path.Join(docset, "index.json"))
+	if err != nil {
+		return m, fmt.Errorf("searched for docset with slug %q: %w", docset, err)
+	}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("could not parse index of docset %q: %w", docset, err)
+	}
+
+	m.Docset = docset
+	return m, nil
+}
+
+func (s *DirSource) GetDocument(ctx context.Context, docset string, entry EntryLocator) (*HTMLDocument, error) {
+	data, err := s.readFile(path.Join(docset, entry.Path+".html"))
+	if errors.Is(err, ErrNotFound) {
+		data, err = s.findDatabaseDocument(docset, entry.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("searched for path %q in docset %q: %w", entry.Path, docset, err)
+	}
+
+	return NewHTMLDocument(docset, entry, data), nil
+}
+
+func (s *DirSource) findDatabaseDocument(docset string, docPath string) ([]byte, error) {
+	name := path.Join(docset, "db.json")
+	if !fs.ValidPath(name) {
+		return nil, ErrNotFound
+	}
+
+	f, err := s.fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	html, ok, err := findDatabaseDocument(f, docPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read database of docset %q: %w", docset, err)
+	}
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return html, nil
+}
+
+// ReadIndex reads the index.json of a docset.
+func (s *DirSource) ReadIndex(docset string) ([]byte, error) {
+	data, err := s.readFile(path.Join(docset, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("searched for index of docset %q: %w", docset, err)
+	}
+
+	return data, nil
+}
+
+// ReadDatabase reads the db.json of a docset. Without one, it bundles the
+// HTML documents of the docset's entries into one.
+func (s *DirSource) ReadDatabase(ctx context.Context, docset string) ([]byte, error) {
+	data, err := s.readFile(path.Join(docset, "db.json"))
+	if !errors.Is(err, ErrNotFound) {
+		return data, err
+	}
+
+	m, err := s.ListEntries(ctx, docset)
+	if err != nil {
+		return nil, err
+	}
+
+	db := make(map[string]string)
+	for _, e := range m.Entries {
+		p := NewEntryLocator(e.Path).Path
+		if _, ok := db[p]; ok {
+			continue
+		}
+
+		html, err := s.readFile(path.Join(docset, p+".html"))
+		if err != nil {
+			return nil, fmt.Errorf("searched for path %q in docset %q: %w", p, docset, err)
+		}
+
+		db[p] = string(html)
+	}
+
+	return json.Marshal(db)
+}
+
+// readFile reads a file, turning missing files into [ErrNotFound]. Names
+// that would escape the directory are missing too.
+func (s *DirSource) readFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, ErrNotFound
+	}
+
+	data, err := fs.ReadFile(s.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
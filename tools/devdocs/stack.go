@@ -1,5 +1,7 @@
 package main
 
+import "slices"
+
 type stack[T any] struct {
 	slice []T
 }
@@ -32,3 +34,8 @@ func (s *stack[T]) Pop() (value T, ok bool) {
 	s.slice = s.slice[:len(s.slice)-1]
 	return value, true
 }
+
+// Values returns the values on the stack, from the bottom up.
+func (s *stack[T]) Values() []T {
+	return slices.Clone(s.slice)
+}